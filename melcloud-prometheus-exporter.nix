@@ -3,11 +3,26 @@ with lib;
 let
   melcloudPrometheusExporter = pkgs.callPackage ./default.nix {};
   cfg = config.services.melcloud-prometheus-exporter;
-  configPath = pkgs.writeText "melcloud-prometheus-exporter.json" (builtins.toJSON cfg.config);
+  # With `passwordFile`, any password set in `config` is dropped so that it doesn't end up in the
+  # store, and can't conflict with the credential.
+  settings = if cfg.passwordFile == null then cfg.config else cfg.config // {
+    MELCloudConfig = removeAttrs (cfg.config.MELCloudConfig or { }) [ "Password" ] // {
+      PasswordFile = "\${CREDENTIALS_DIRECTORY}/melcloud-password";
+    };
+  };
+  configPath = pkgs.writeText "melcloud-prometheus-exporter.json" (builtins.toJSON settings);
 in {
   options.services.melcloud-prometheus-exporter = {
     enable = mkEnableOption "melcloud-prometheus-exporter service";
     config = mkOption { };
+    passwordFile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = ''
+        File containing the MELCloud password, passed to the service as a systemd credential so
+        that it doesn't end up in the world-readable store.
+      '';
+    };
   };
 
   config = mkIf cfg.enable {
@@ -19,9 +34,14 @@ in {
       serviceConfig = {
         User = "melcloud-prometheus-exporter";
         ExecStart = "${melcloudPrometheusExporter}/bin/melcloud-prometheus-exporter '${configPath}'";
+        ExecReload = "${pkgs.coreutils}/bin/kill -HUP $MAINPID";
         DynamicUser = true;
+        # Use "/var/lib/melcloud-prometheus-exporter/session.json" as `MELCloudConfig.StateFile`
+        # to persist the MELCloud session across restarts.
+        StateDirectory = "melcloud-prometheus-exporter";
         Restart = "on-failure";
         RestartSec = 180;
+        LoadCredential = optional (cfg.passwordFile != null) "melcloud-password:${cfg.passwordFile}";
       };
     };
   };
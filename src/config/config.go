@@ -2,21 +2,114 @@ package config
 
 type DeviceType string
 
-const (
-    DeviceTypeEcodan DeviceType = "ecodan"
-)
-
 type Config struct {
     ListenAddress string `default:"localhost:9102"`
+    // Optional path to a web config file (YAML) of the Prometheus exporter-toolkit, enabling TLS
+    // and basic authentication on the listener.
+    WebConfigFile string
+    // Start serving metrics right away and keep retrying in the background if MELCloud can't be
+    // reached at startup, instead of exiting.
+    ServeBeforeInitialFetch bool
+    // `/readyz` fails unless at least one device was fetched successfully within this window.
+    ReadinessWindow Duration `default:"10m"`
+    // Timestamp attached to exported samples, one of the TimestampMode* constants.
+    Timestamps TimestampMode `default:"last_update"`
+    // IANA name of the time zone the MELCloud buildings are in, e.g. "Europe/Rome". MELCloud
+    // reports times in building-local time. Defaults to the local time zone of the system;
+    // before this option existed, times were interpreted as UTC, so set it to "UTC" to keep the
+    // previous behaviour.
+    TimeZone string
     MELCloudConfig MELCloudConfig
     Devices []MELCloudDeviceDescriptor
+    // How often the configuration file is checked for changes, reloading it when it's modified,
+    // as on SIGHUP. Zero disables the check.
+    ReloadCheckInterval Duration
+    // How often energy reports are fetched for devices which support them.
+    EnergyReportInterval Duration `default:"30m"`
+    Discovery DiscoveryConfig
+    Polling PollingConfig
+
+    // Problems found while parsing, reported by Validate.
+    problems ValidationError
+}
+
+type PollingConfig struct {
+    // Bounds to the interval between two polls of the same device, which otherwise follows
+    // the next communication time suggested by MELCloud. Can be overridden per device.
+    MinInterval Duration `default:"1m10s"`
+    MaxInterval Duration `default:"5m"`
+    // Maximum number of devices polled at the same time.
+    MaxConcurrency int `default:"1"`
+    // Minimum time between the start of two polls, across all devices.
+    MinSpacing Duration
+    Backoff BackoffConfig
+}
+
+// Policy applied to devices which fail to be fetched. The n-th consecutive failure waits for
+// Base * Multiplier^(n-1), capped at Max.
+type BackoffConfig struct {
+    Base Duration `default:"2m"`
+    Max Duration `default:"16m"`
+    Multiplier float64 `default:"2"`
+    // Fraction of each wait which is randomized, so that exporters started together don't
+    // synchronise their requests. Also applied, as an additional delay, to regular polls, which
+    // are still never delayed past the maximum interval. Must be less than 1.
+    Jitter float64 `default:"0.1"`
+}
+
+type DiscoveryConfig struct {
+    // Whether devices on the account are discovered automatically, on top of `Devices`.
+    Enabled bool
+    Interval Duration `default:"1h"`
+    // Device IDs or names to restrict discovery to. Empty means all supported devices.
+    Include []string
+    // Device IDs or names to ignore.
+    Exclude []string
+    // Labels to use for discovered devices, keyed by device ID. By default, labels are derived
+    // from the device name.
+    Labels map[string]string
+    // Settings of discovered devices, keyed by device ID.
+    Overrides map[string]DeviceOverrides
+}
+
+// Per-device settings which can be applied to discovered devices, see MELCloudDeviceDescriptor.
+type DeviceOverrides struct {
+    MaxAge, MinInterval, MaxInterval Duration
 }
 
 type MELCloudConfig struct {
-    Mail, Password string
+    // Either can reference environment variables as `${NAME}`.
+    Mail string `excludes:"MailFile"`
+    Password string `excludes:"PasswordFile"`
+    // Files to read `Mail` and `Password` from instead, such as systemd credentials.
+    MailFile string `excludes:"Mail"`
+    PasswordFile string `excludes:"Password"`
+    // Optional path where the MELCloud session is cached across restarts.
+    StateFile string
+    // MELCloud API endpoint and the app version reported to it. Only meant to be changed when
+    // MELCloud starts rejecting the default app version, or for testing.
+    BaseURL string `default:"https://app.melcloud.com/Mitsubishi.Wifi.Client"`
+    AppVersion string `default:"1.32.1.0"`
+    RateLimit RateLimitConfig
+}
+
+type RateLimitConfig struct {
+    // Average number of requests issued to MELCloud per hour, across all devices. Zero means
+    // unlimited. Lower it when several exporters share the same account.
+    RequestsPerHour int
+    // Maximum number of requests issued in a burst.
+    Burst int `default:"10"`
 }
 
 type MELCloudDeviceDescriptor struct {
     Type DeviceType
     Label, Id, BuildingId string
+    // Name of the device on MELCloud. Informational only.
+    Name string `json:",omitempty"`
+    // Statistics of devices which didn't communicate with MELCloud for longer than this are no
+    // longer exported. Unset means no limit.
+    MaxAge Duration `json:",omitempty"`
+    // Overrides of the polling interval bounds for this device.
+    MinInterval Duration `json:",omitempty"`
+    MaxInterval Duration `json:",omitempty"`
 }
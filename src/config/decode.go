@@ -0,0 +1,156 @@
+package config
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decode decodes the JSON document `data` into the struct pointed to by `v` one field at a
+// time, so that every unknown field and invalid value is reported along with its path, rather
+// than only the first one. Only malformed JSON fails the decoding as a whole.
+func decode(data []byte, v interface{}) (ValidationError, error) {
+    if !json.Valid(data) {
+        var discard interface{}
+        if err := json.Unmarshal(data, &discard); err != nil {
+            return nil, err
+        }
+        return nil, errors.New("unexpected data after the top-level value")
+    }
+
+    var problems ValidationError
+    decodeValue(reflect.ValueOf(v).Elem(), data, "", &problems)
+
+    return problems, nil
+}
+
+func decodeValue(v reflect.Value, data json.RawMessage, path string, problems *ValidationError) {
+    fail := func(path string, err error) {
+        *problems = append(*problems, &FieldError{Path: path, Err: err})
+    }
+
+    // Values with their own decoding, and anything which can't contain structs, are decoded as
+    // a whole.
+    if v.Addr().Type().Implements(unmarshalerType) || !containsStruct(v.Type()) {
+        if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+            fail(path, err)
+        }
+        return
+    }
+
+    switch v.Kind() {
+    case reflect.Struct:
+        var fields map[string]json.RawMessage
+        if err := json.Unmarshal(data, &fields); err != nil {
+            fail(path, err)
+            return
+        }
+
+        for _, name := range sortedRawKeys(fields) {
+            field, ok := lookupField(v.Type(), name)
+            if !ok {
+                fail(joinPath(path, name), errors.New("unknown field"))
+                continue
+            }
+
+            decodeValue(v.FieldByIndex(field.Index), fields[name], joinPath(path, field.Name), problems)
+        }
+
+    case reflect.Slice:
+        var items []json.RawMessage
+        if err := json.Unmarshal(data, &items); err != nil {
+            fail(path, err)
+            return
+        }
+
+        if items == nil {
+            v.Set(reflect.Zero(v.Type()))
+            return
+        }
+
+        v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+        for i, item := range items {
+            decodeValue(v.Index(i), item, fmt.Sprintf("%v[%d]", path, i), problems)
+        }
+
+    case reflect.Map:
+        var items map[string]json.RawMessage
+        if err := json.Unmarshal(data, &items); err != nil {
+            fail(path, err)
+            return
+        }
+
+        if items == nil {
+            v.Set(reflect.Zero(v.Type()))
+            return
+        }
+
+        v.Set(reflect.MakeMapWithSize(v.Type(), len(items)))
+        for _, key := range sortedRawKeys(items) {
+            item := reflect.New(v.Type().Elem()).Elem()
+            decodeValue(item, items[key], fmt.Sprintf("%v[%q]", path, key), problems)
+            v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), item)
+        }
+    }
+}
+
+// containsStruct returns whether values of type `t` are, or hold, structs decoded field by field.
+func containsStruct(t reflect.Type) bool {
+    if reflect.PtrTo(t).Implements(unmarshalerType) {
+        return false
+    }
+
+    switch t.Kind() {
+    case reflect.Struct:
+        return true
+    case reflect.Slice, reflect.Map:
+        return containsStruct(t.Elem())
+    }
+
+    return false
+}
+
+// lookupField finds the struct field `name` refers to, matching case-insensitively like
+// encoding/json does.
+func lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+    var match reflect.StructField
+    found := false
+
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if field.PkgPath != "" {
+            continue
+        }
+
+        fieldName := field.Name
+        if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+            continue
+        } else if tag != "" {
+            fieldName = tag
+        }
+
+        if fieldName == name {
+            return field, true
+        }
+
+        if !found && strings.EqualFold(fieldName, name) {
+            match, found = field, true
+        }
+    }
+
+    return match, found
+}
+
+func sortedRawKeys(m map[string]json.RawMessage) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "time"
+)
+
+// applyDefaults sets the fields of the struct pointed to by `v`, and of the structs nested in
+// it, to the value of their `default` tag. It is applied before decoding, so that the values
+// set explicitly in the config file, including zero values, take precedence.
+func applyDefaults(v interface{}) error {
+    return applyStructDefaults(reflect.ValueOf(v).Elem(), "")
+}
+
+func applyStructDefaults(v reflect.Value, path string) error {
+    t := v.Type()
+
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        value := v.Field(i)
+        fieldPath := joinPath(path, field.Name)
+
+        if field.Type.Kind() == reflect.Struct {
+            if err := applyStructDefaults(value, fieldPath); err != nil {
+                return err
+            }
+            continue
+        }
+
+        tag, ok := field.Tag.Lookup("default")
+        if !ok {
+            continue
+        }
+
+        if err := setDefault(value, tag); err != nil {
+            return fmt.Errorf("invalid default for %v: %w", fieldPath, err)
+        }
+    }
+
+    return nil
+}
+
+func setDefault(value reflect.Value, tag string) error {
+    if value.Type() == reflect.TypeOf(Duration(0)) {
+        d, err := time.ParseDuration(tag)
+        if err != nil {
+            return err
+        }
+        value.SetInt(int64(d))
+        return nil
+    }
+
+    switch value.Kind() {
+    case reflect.String:
+        value.SetString(tag)
+    case reflect.Int, reflect.Int64:
+        n, err := strconv.ParseInt(tag, 10, 64)
+        if err != nil {
+            return err
+        }
+        value.SetInt(n)
+    case reflect.Float64:
+        f, err := strconv.ParseFloat(tag, 64)
+        if err != nil {
+            return err
+        }
+        value.SetFloat(f)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(tag)
+        if err != nil {
+            return err
+        }
+        value.SetBool(b)
+    default:
+        return fmt.Errorf("unsupported type %v", value.Type())
+    }
+
+    return nil
+}
+
+func joinPath(path, field string) string {
+    if path == "" {
+        return field
+    }
+    return path + "." + field
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+)
+
+// Duration is a time.Duration which is represented in the config as a string accepted by
+// time.ParseDuration, e.g. "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+    var value string
+    if err := json.Unmarshal(b, &value); err != nil {
+        return fmt.Errorf("durations must be strings such as \"1m30s\": %w", err)
+    }
+
+    parsed, err := time.ParseDuration(value)
+    if err != nil {
+        return err
+    }
+
+    *d = Duration(parsed)
+
+    return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+// Or returns the duration, or `fallback` if the duration is unset, such as a per-device
+// setting which defers to the global one.
+func (d Duration) Or(fallback time.Duration) time.Duration {
+    if d == 0 {
+        return fallback
+    }
+
+    return time.Duration(d)
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "reflect"
+    "regexp"
+    "strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding config fields. The rest of
+// the variable name is the JSON path of the field, upper-cased and with `_` as separator, e.g.
+// MELCLOUD_PROMETHEUS_EXPORTER_MELCLOUDCONFIG_PASSWORD or
+// MELCLOUD_PROMETHEUS_EXPORTER_POLLING_BACKOFF_BASE.
+const EnvPrefix = "MELCLOUD_PROMETHEUS_EXPORTER_"
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// applyEnvOverrides overrides the fields of the struct pointed to by `v` with the environment
+// variables named after them. Strings and durations are taken verbatim, any other value,
+// including lists such as `Devices`, is decoded as JSON. Overriding a field with an `excludes`
+// tag clears the field it names, so that e.g. a password from the environment replaces the
+// password file of the config file. Invalid values are reported with the path of their field.
+func applyEnvOverrides(v interface{}, lookupEnv func(string) (string, bool)) ValidationError {
+    var problems ValidationError
+    applyStructEnvOverrides(reflect.ValueOf(v).Elem(), "", lookupEnv, &problems)
+    return problems
+}
+
+func applyStructEnvOverrides(
+    v reflect.Value,
+    path string,
+    lookupEnv func(string) (string, bool),
+    problems *ValidationError,
+) {
+    t := v.Type()
+
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        value := v.Field(i)
+        fieldPath := joinPath(path, field.Name)
+
+        if field.PkgPath != "" {
+            continue
+        }
+
+        if field.Type.Kind() == reflect.Struct {
+            applyStructEnvOverrides(value, fieldPath, lookupEnv, problems)
+            continue
+        }
+
+        name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(fieldPath, ".", "_"))
+        raw, ok := lookupEnv(name)
+        if !ok {
+            continue
+        }
+
+        if excluded, ok := field.Tag.Lookup("excludes"); ok {
+            other := v.FieldByName(excluded)
+            other.Set(reflect.Zero(other.Type()))
+        }
+
+        if field.Type.Kind() == reflect.String {
+            value.SetString(raw)
+            continue
+        }
+
+        data := []byte(raw)
+        if field.Type == durationType {
+            data, _ = json.Marshal(raw)
+        }
+
+        if err := json.Unmarshal(data, value.Addr().Interface()); err != nil {
+            *problems = append(*problems, &FieldError{Path: fieldPath, Err: fmt.Errorf("from %v: %w", name, err)})
+        }
+    }
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the `${NAME}` references in `s` with the value of the corresponding
+// environment variables, failing if any of them is unset. Other uses of `$` are left alone, so
+// that they can appear in passwords.
+func expandEnv(s string, lookupEnv func(string) (string, bool)) (string, error) {
+    var err error
+
+    expanded := envReference.ReplaceAllStringFunc(s, func(reference string) string {
+        name := envReference.FindStringSubmatch(reference)[1]
+        value, ok := lookupEnv(name)
+        if !ok && err == nil {
+            err = fmt.Errorf("environment variable '%v' is not set", name)
+        }
+        return value
+    })
+
+    return expanded, err
+}
+
+// resolveCredentials expands the environment variable references in the MELCloud settings and
+// reads the credentials from `MailFile` and `PasswordFile`, if set. These work with systemd's
+// `LoadCredential`, e.g. `"PasswordFile": "${CREDENTIALS_DIRECTORY}/melcloud-password"`.
+func (c *MELCloudConfig) resolveCredentials(lookupEnv func(string) (string, bool)) ValidationError {
+    v := &validator{}
+
+    fields := []struct {
+        path string
+        value *string
+    }{
+        {"MELCloudConfig.Mail", &c.Mail},
+        {"MELCloudConfig.MailFile", &c.MailFile},
+        {"MELCloudConfig.Password", &c.Password},
+        {"MELCloudConfig.PasswordFile", &c.PasswordFile},
+        {"MELCloudConfig.StateFile", &c.StateFile},
+    }
+
+    for _, field := range fields {
+        expanded, err := expandEnv(*field.value, lookupEnv)
+        if err != nil {
+            v.fail(field.path, "%v", err)
+            continue
+        }
+        *field.value = expanded
+    }
+
+    v.readCredential("Mail", &c.Mail, c.MailFile)
+    v.readCredential("Password", &c.Password, c.PasswordFile)
+
+    return v.errors
+}
+
+func (v *validator) readCredential(name string, value *string, path string) {
+    if path == "" {
+        return
+    }
+
+    if *value != "" {
+        v.fail("MELCloudConfig." + name + "File", "mutually exclusive with %v", name)
+        return
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        v.fail("MELCloudConfig." + name + "File", "%v", err)
+        return
+    }
+
+    *value = strings.TrimRight(string(data), "\r\n")
+}
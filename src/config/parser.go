@@ -1,24 +1,33 @@
 package config
 
 import (
-    "encoding/json"
     "fmt"
     "os"
 )
 
+// Parse decodes the config file, on top of the defaults declared by the `default` tags of the
+// config fields, then applies the overrides from the environment and resolves the MELCloud
+// credentials. The result still needs to be validated: unknown fields, values which can't be
+// decoded, invalid overrides and unreadable credentials are reported by Validate, along with the
+// other problems, and only malformed JSON fails parsing.
 func Parse(path string) (*Config, error) {
-    c, err := os.Open(path)
+    data, err := os.ReadFile(path)
     if err != nil {
         return nil, fmt.Errorf("Unable to open config file for reading: %w", err)
     }
 
-    defer c.Close()
-
     cfg := Config{}
-    d := json.NewDecoder(c)
-    if err = d.Decode(&cfg); err != nil {
+    if err = applyDefaults(&cfg); err != nil {
+        return nil, err
+    }
+
+    cfg.problems, err = decode(data, &cfg)
+    if err != nil {
         return nil, fmt.Errorf("Unable to decode config file: %w", err)
     }
 
+    cfg.problems = append(cfg.problems, applyEnvOverrides(&cfg, os.LookupEnv)...)
+    cfg.problems = append(cfg.problems, cfg.MELCloudConfig.resolveCredentials(os.LookupEnv)...)
+
     return &cfg, nil
 }
@@ -0,0 +1,23 @@
+package config
+
+// TimestampMode controls which timestamp, if any, is attached to exported samples.
+type TimestampMode string
+
+const (
+    // Samples carry the time the statistics were last fetched from MELCloud. This is the
+    // default.
+    TimestampModeLastUpdate TimestampMode = "last_update"
+    // Samples carry no timestamp, letting Prometheus use the scrape time.
+    TimestampModeNone TimestampMode = "none"
+    // Samples carry the time the device last communicated with MELCloud.
+    TimestampModeLastCommunication TimestampMode = "last_communication"
+)
+
+func (m TimestampMode) Valid() bool {
+    switch m {
+    case "", TimestampModeLastUpdate, TimestampModeNone, TimestampModeLastCommunication:
+        return true
+    default:
+        return false
+    }
+}
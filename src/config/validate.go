@@ -0,0 +1,212 @@
+package config
+
+import (
+    "fmt"
+    "net"
+    "net/url"
+    "sort"
+    "strings"
+    "time"
+)
+
+// FieldError is a problem with the value of a config field, identified by its JSON path.
+type FieldError struct {
+    Path string
+    Err error
+}
+
+func (e *FieldError) Error() string {
+    return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+    return e.Err
+}
+
+// ValidationError lists every problem found while validating a config.
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+    problems := make([]string, len(e))
+    for i, err := range e {
+        problems[i] = err.Error()
+    }
+
+    return fmt.Sprintf("invalid config:\n  %v", strings.Join(problems, "\n  "))
+}
+
+func sortedKeys(m map[string]string) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// validator accumulates the problems found in a config.
+type validator struct {
+    errors ValidationError
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+    v.errors = append(v.errors, &FieldError{Path: path, Err: fmt.Errorf(format, args...)})
+}
+
+func (v *validator) checkNonNegative(path string, d Duration) {
+    if d < 0 {
+        v.fail(path, "must not be negative")
+    }
+}
+
+func (v *validator) checkPositive(path string, d Duration) {
+    if d <= 0 {
+        v.fail(path, "must be positive")
+    }
+}
+
+func (v *validator) checkInterval(path string, min, max Duration) {
+    v.checkNonNegative(path + ".MinInterval", min)
+    v.checkNonNegative(path + ".MaxInterval", max)
+
+    if min > 0 && max > 0 && min > max {
+        v.fail(path, "MinInterval (%v) is greater than MaxInterval (%v)", time.Duration(min), time.Duration(max))
+    }
+}
+
+// Validate checks the config for problems, returning a ValidationError listing all of them.
+// Devices are additionally checked with `validateDevice`, which is expected to reject unknown
+// device types and descriptors the driver can't handle.
+func (c *Config) Validate(validateDevice func(MELCloudDeviceDescriptor) error) error {
+    v := &validator{errors: append(ValidationError(nil), c.problems...)}
+
+    if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+        v.fail("ListenAddress", "%v", err)
+    }
+
+    v.checkPositive("ReadinessWindow", c.ReadinessWindow)
+
+    if !c.Timestamps.Valid() {
+        v.fail("Timestamps", "unknown timestamp mode '%v'", c.Timestamps)
+    }
+
+    if c.TimeZone != "" {
+        if _, err := time.LoadLocation(c.TimeZone); err != nil {
+            v.fail("TimeZone", "%v", err)
+        }
+    }
+
+    if u, err := url.Parse(c.MELCloudConfig.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+        v.fail("MELCloudConfig.BaseURL", "must be an absolute URL")
+    }
+
+    if c.MELCloudConfig.AppVersion == "" {
+        v.fail("MELCloudConfig.AppVersion", "missing")
+    }
+
+    if c.MELCloudConfig.Mail == "" {
+        v.fail("MELCloudConfig.Mail", "missing, set either Mail or MailFile")
+    }
+
+    if c.MELCloudConfig.Password == "" {
+        v.fail("MELCloudConfig.Password", "missing, set either Password or PasswordFile")
+    }
+
+    if rateLimit := c.MELCloudConfig.RateLimit; rateLimit.RequestsPerHour < 0 {
+        v.fail("MELCloudConfig.RateLimit.RequestsPerHour", "must not be negative")
+    } else if rateLimit.RequestsPerHour > 0 && rateLimit.Burst < 1 {
+        v.fail("MELCloudConfig.RateLimit.Burst", "must be at least 1")
+    }
+
+    labels := make(map[string]int, len(c.Devices))
+    for i, descriptor := range c.Devices {
+        path := fmt.Sprintf("Devices[%d]", i)
+
+        if descriptor.Label == "" {
+            v.fail(path + ".Label", "missing")
+        } else if j, ok := labels[descriptor.Label]; ok {
+            v.fail(path + ".Label", "duplicated label '%v', already used by Devices[%d]", descriptor.Label, j)
+        } else {
+            labels[descriptor.Label] = i
+        }
+
+        v.checkNonNegative(path + ".MaxAge", descriptor.MaxAge)
+        v.checkInterval(path, descriptor.MinInterval, descriptor.MaxInterval)
+
+        if err := validateDevice(descriptor); err != nil {
+            v.fail(path, "%v", err)
+        }
+    }
+
+    v.checkPositive("EnergyReportInterval", c.EnergyReportInterval)
+
+    v.checkNonNegative("ReloadCheckInterval", c.ReloadCheckInterval)
+
+    if c.Discovery.Enabled {
+        v.checkPositive("Discovery.Interval", c.Discovery.Interval)
+    }
+
+    discoveredLabels := make(map[string]string, len(c.Discovery.Labels))
+    for _, id := range sortedKeys(c.Discovery.Labels) {
+        label := c.Discovery.Labels[id]
+        path := fmt.Sprintf("Discovery.Labels[%q]", id)
+
+        if label == "" {
+            v.fail(path, "empty label")
+        } else if i, ok := labels[label]; ok {
+            v.fail(path, "label '%v' is already used by Devices[%d]", label, i)
+        } else if other, ok := discoveredLabels[label]; ok {
+            v.fail(path, "label '%v' is already used by device %v", label, other)
+        } else {
+            discoveredLabels[label] = id
+        }
+    }
+
+    overrideIds := make([]string, 0, len(c.Discovery.Overrides))
+    for id := range c.Discovery.Overrides {
+        overrideIds = append(overrideIds, id)
+    }
+    sort.Strings(overrideIds)
+
+    for _, id := range overrideIds {
+        overrides := c.Discovery.Overrides[id]
+        path := fmt.Sprintf("Discovery.Overrides[%q]", id)
+        v.checkNonNegative(path + ".MaxAge", overrides.MaxAge)
+        v.checkInterval(path, overrides.MinInterval, overrides.MaxInterval)
+    }
+
+    // Unlike the per-device settings, the global ones have nothing to fall back to.
+    v.checkPositive("Polling.MinInterval", c.Polling.MinInterval)
+    v.checkPositive("Polling.MaxInterval", c.Polling.MaxInterval)
+
+    if c.Polling.MinInterval > c.Polling.MaxInterval {
+        v.fail("Polling", "MinInterval (%v) is greater than MaxInterval (%v)", time.Duration(c.Polling.MinInterval), time.Duration(c.Polling.MaxInterval))
+    }
+    v.checkNonNegative("Polling.MinSpacing", c.Polling.MinSpacing)
+
+    if c.Polling.MaxConcurrency < 1 {
+        v.fail("Polling.MaxConcurrency", "must be at least 1")
+    }
+
+    backoff := c.Polling.Backoff
+    v.checkPositive("Polling.Backoff.Base", backoff.Base)
+    v.checkPositive("Polling.Backoff.Max", backoff.Max)
+
+    if backoff.Base > 0 && backoff.Max > 0 && backoff.Base > backoff.Max {
+        v.fail("Polling.Backoff", "Base (%v) is greater than Max (%v)", time.Duration(backoff.Base), time.Duration(backoff.Max))
+    }
+
+    if backoff.Multiplier < 1 {
+        v.fail("Polling.Backoff.Multiplier", "must be at least 1")
+    }
+
+    if backoff.Jitter < 0 || backoff.Jitter >= 1 {
+        v.fail("Polling.Backoff.Jitter", "must be at least 0 and less than 1")
+    }
+
+    if len(v.errors) > 0 {
+        return v.errors
+    }
+
+    return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "github.com/rs/zerolog/log"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+    "rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+// labelFromName turns a MELCloud device name into a label, e.g. "Living Room" -> "living_room".
+func labelFromName(name string) string {
+    label := strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return unicode.ToLower(r)
+        }
+        return '_'
+    }, strings.TrimSpace(name))
+
+    return strings.Trim(label, "_")
+}
+
+// uniqueLabel derives a label from the name of a device which is not part of `taken`, falling
+// back to appending the device ID and then a counter.
+func uniqueLabel(name, id string, taken map[string]bool) string {
+    label := labelFromName(name)
+    if label != "" && !taken[label] {
+        return label
+    }
+
+    label = strings.TrimPrefix(label + "_" + id, "_")
+    for candidate, i := label, 2; ; i++ {
+        if !taken[candidate] {
+            return candidate
+        }
+        candidate = fmt.Sprintf("%v_%d", label, i)
+    }
+}
+
+func matchesAny(id, name string, patterns []string) bool {
+    for _, pattern := range patterns {
+        if pattern == id || pattern == name {
+            return true
+        }
+    }
+    return false
+}
+
+// discoveryAllows returns whether a device passes the Include and Exclude filters.
+func discoveryAllows(cfg config.DiscoveryConfig, id, name string) bool {
+    return (len(cfg.Include) == 0 || matchesAny(id, name, cfg.Include)) && !matchesAny(id, name, cfg.Exclude)
+}
+
+// applyDiscoverySettings sets the label and the overrides configured for a discovered device.
+// Unless configured, the label is derived from the device name and must not be part of `taken`.
+func applyDiscoverySettings(
+    cfg config.DiscoveryConfig,
+    descriptor config.MELCloudDeviceDescriptor,
+    taken map[string]bool,
+) config.MELCloudDeviceDescriptor {
+    label, ok := cfg.Labels[descriptor.Id]
+    if !ok {
+        label = uniqueLabel(descriptor.Name, descriptor.Id, taken)
+    }
+
+    overrides := cfg.Overrides[descriptor.Id]
+
+    descriptor.Label = label
+    descriptor.MaxAge = overrides.MaxAge
+    descriptor.MinInterval = overrides.MinInterval
+    descriptor.MaxInterval = overrides.MaxInterval
+
+    return descriptor
+}
+
+// discoverDevices lists the devices on the account and returns descriptors for the supported
+// ones which are allowed by the discovery config and not already part of `known`.
+func discoverDevices(
+    ctx context.Context,
+    requestor *melcloud.MelcloudRequestor,
+    cfg config.DiscoveryConfig,
+    known []config.MELCloudDeviceDescriptor,
+) ([]config.MELCloudDeviceDescriptor, error) {
+    devices, err := requestor.ListDevices(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("unable to list devices: %w", err)
+    }
+
+    knownIds := make(map[string]bool, len(known))
+    labels := make(map[string]bool, len(known))
+    for _, descriptor := range known {
+        knownIds[descriptor.Id] = true
+        labels[descriptor.Label] = true
+    }
+
+    // Generated labels must not take the ones reserved for other devices.
+    for _, label := range cfg.Labels {
+        labels[label] = true
+    }
+
+    var discovered []config.MELCloudDeviceDescriptor
+
+    for _, device := range devices {
+        id := strconv.Itoa(device.DeviceID)
+
+        if knownIds[id] {
+            continue
+        }
+
+        if !discoveryAllows(cfg, id, device.DeviceName) {
+            log.Debug().Str("DeviceID", id).Str("Name", device.DeviceName).Msg("Ignoring filtered device")
+            continue
+        }
+
+        factory, ok := driver.LookupMELCloudType(device.Type)
+        if !ok {
+            log.Debug().
+                Str("DeviceID", id).
+                Str("Name", device.DeviceName).
+                Stringer("MELCloudType", device.Type).
+                Msg("Ignoring device of unsupported type")
+            continue
+        }
+
+        descriptor := applyDiscoverySettings(cfg, config.MELCloudDeviceDescriptor{
+            Type: factory.Type,
+            Id: id,
+            BuildingId: strconv.Itoa(device.BuildingID),
+            Name: device.DeviceName,
+        }, labels)
+
+        log.Info().
+            Str("Label", descriptor.Label).
+            Str("DeviceType", string(descriptor.Type)).
+            Str("DeviceID", descriptor.Id).
+            Str("BuildingID", descriptor.BuildingId).
+            Msg("Discovered device")
+
+        knownIds[id] = true
+        labels[descriptor.Label] = true
+        discovered = append(discovered, descriptor)
+    }
+
+    return discovered, nil
+}
@@ -0,0 +1,154 @@
+package ata
+
+import (
+  "time"
+
+  "github.com/prometheus/client_golang/prometheus"
+  "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+var (
+  descOperationMode = prometheus.NewDesc(
+    "ata_operation_mode",
+    "Operation mode for the air-to-air unit. " + driver.OperationModeHelpString(),
+    nil,
+    nil,
+  )
+  descRoomTemperature = prometheus.NewDesc(
+    "ata_room_temperature_celsius",
+    "Room temperature measured by the air-to-air unit.",
+    nil,
+    nil,
+  )
+  descTemperatureSetpoint = prometheus.NewDesc(
+    "ata_temperature_setpoint_celsius",
+    "Room temperature setpoint for the air-to-air unit.",
+    nil,
+    nil,
+  )
+  descFanSpeed = prometheus.NewDesc(
+    "ata_fan_speed",
+    "Fan speed of the air-to-air unit. 0 means automatic.",
+    nil,
+    nil,
+  )
+  descFanSpeedCount = prometheus.NewDesc(
+    "ata_fan_speeds",
+    "Number of fan speeds supported by the air-to-air unit.",
+    nil,
+    nil,
+  )
+  descVanePosition = prometheus.NewDesc(
+    "ata_vane_position",
+    "Vane position of the air-to-air unit. 0 means automatic, 1 to 5 are fixed positions, " +
+      "7 (vertical) and 12 (horizontal) mean swing.",
+    []string{"direction"},
+    nil,
+  )
+  descPower = prometheus.NewDesc(
+    "ata_power_on",
+    "Power state of the air-to-air unit.",
+    nil,
+    nil,
+  )
+  descOffline = prometheus.NewDesc(
+    "ata_offline",
+    "Whether the air-to-air unit is offline.",
+    nil,
+    nil,
+  )
+  descLastCommunication = prometheus.NewDesc(
+    "ata_last_communication_timestamp_seconds",
+    "Unix timestamp of the last communication between the air-to-air unit and MELCloud.",
+    nil,
+    nil,
+  )
+  descStale = prometheus.NewDesc(
+    "ata_stale",
+    "Whether the air-to-air unit last communicated with MELCloud longer ago than the configured max age, in which case its statistics are not exported.",
+    nil,
+    nil,
+  )
+  descLastUpdate = prometheus.NewDesc(
+    "ata_last_update_timestamp_seconds",
+    "Unix timestamp of the last statistics update for the air-to-air unit.",
+    nil,
+    nil,
+  )
+  allDescriptors = []*prometheus.Desc{
+    descOperationMode,
+    descRoomTemperature,
+    descTemperatureSetpoint,
+    descFanSpeed,
+    descFanSpeedCount,
+    descVanePosition,
+    descPower,
+    descOffline,
+    descLastCommunication,
+    descStale,
+    descLastUpdate,
+  }
+)
+
+type StatsProvider interface {
+  Stats() (*AtaStatistics, time.Time)
+}
+
+type collector struct {
+  provider StatsProvider
+  opts driver.CollectorOptions
+}
+
+func toBool(v bool) float64 {
+  if v {
+    return 1
+  }
+  return 0
+}
+
+func sendWithTimestamp(ch chan<- prometheus.Metric, t time.Time, m prometheus.Metric) {
+  if t.IsZero() {
+    ch <- m
+    return
+  }
+  ch <- prometheus.NewMetricWithTimestamp(t, m)
+}
+
+func (collector collector) Describe(ch chan<- *prometheus.Desc) {
+  for _, desc := range allDescriptors {
+    ch <- desc
+  }
+}
+
+func (collector collector) Collect(ch chan<- prometheus.Metric) {
+  stats, t := collector.provider.Stats()
+
+  if stats == nil {
+    return
+  }
+
+  if driver.CollectFreshness(ch, descStale, descLastUpdate, t, time.Time(stats.LastCommunication), collector.opts) {
+    return
+  }
+
+  t = collector.opts.SampleTime(t, time.Time(stats.LastCommunication))
+
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOperationMode, prometheus.GaugeValue, float64(stats.OperationMode)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descRoomTemperature, prometheus.GaugeValue, float64(stats.RoomTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descTemperatureSetpoint, prometheus.GaugeValue, float64(stats.SetTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeed, prometheus.GaugeValue, float64(stats.SetFanSpeed)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeedCount, prometheus.GaugeValue, float64(stats.NumberOfFanSpeeds)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descVanePosition, prometheus.GaugeValue, float64(stats.VaneHorizontal), "horizontal"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descVanePosition, prometheus.GaugeValue, float64(stats.VaneVertical), "vertical"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descPower, prometheus.GaugeValue, toBool(stats.Power)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOffline, prometheus.GaugeValue, toBool(stats.Offline)))
+
+  if lastCommunication := time.Time(stats.LastCommunication); !lastCommunication.IsZero() {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descLastCommunication, prometheus.GaugeValue, float64(lastCommunication.Unix())))
+  }
+}
+
+func RegisterCollector(provider StatsProvider, reg prometheus.Registerer, opts driver.CollectorOptions) {
+  collector := collector{provider, opts}
+  reg.MustRegister(collector)
+}
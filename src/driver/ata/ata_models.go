@@ -0,0 +1,55 @@
+package ata
+
+import (
+    "encoding/json"
+
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+type AtaStatistics struct {
+    OperationMode driver.OperationMode `json:"-"`
+
+    RoomTemperature float32
+    SetTemperature float32
+
+    // 0 means automatic, otherwise 1..NumberOfFanSpeeds.
+    SetFanSpeed int
+    NumberOfFanSpeeds int
+
+    // 0 means automatic, 1..5 are fixed positions, 7 (vertical) and 12 (horizontal) mean swing.
+    VaneHorizontal int
+    VaneVertical int
+
+    LastCommunication driver.MitsubishiTime
+    NextCommunication driver.MitsubishiTime
+    Power, Offline, InStandbyMode bool
+
+    RawOperationMode int `json:"OperationMode"`
+}
+
+func (stats *AtaStatistics) UnmarshalJSON(b []byte) error {
+    type rawStats AtaStatistics
+    if err := json.Unmarshal(b, (*rawStats)(stats)); err != nil {
+        return err
+    }
+
+    // Adapt operation mode.
+    switch {
+    case !stats.Power || stats.InStandbyMode:
+        stats.OperationMode = driver.OperationModeIdle
+    case stats.RawOperationMode == 1:
+        stats.OperationMode = driver.OperationModeHeating
+    case stats.RawOperationMode == 2:
+        stats.OperationMode = driver.OperationModeDrying
+    case stats.RawOperationMode == 3:
+        stats.OperationMode = driver.OperationModeCooling
+    case stats.RawOperationMode == 7:
+        stats.OperationMode = driver.OperationModeFan
+    case stats.RawOperationMode == 8:
+        stats.OperationMode = driver.OperationModeAuto
+    default:
+        stats.OperationMode = driver.OperationModeIdle
+    }
+
+    return nil
+}
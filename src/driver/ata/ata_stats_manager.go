@@ -0,0 +1,81 @@
+package ata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"rbf.dev/melcloud_prometheus_exporter/config"
+	"rbf.dev/melcloud_prometheus_exporter/driver"
+	"rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+const DeviceType config.DeviceType = "ata"
+
+func init() {
+    driver.Register(driver.Factory{
+        Type: DeviceType,
+        Description: "Air-to-air split units",
+        MELCloudTypes: []melcloud.DeviceType{melcloud.DeviceTypeATA},
+        New: NewDefaultStatsManager,
+        Validate: driver.ValidateDeviceLocation,
+    })
+}
+
+type statsManager struct {
+    mu sync.RWMutex
+    lastStats *AtaStatistics
+    lastUpdate time.Time
+}
+
+func NewDefaultStatsManager() driver.StatsManager {
+    return &statsManager{}
+}
+
+func (s *statsManager) updateStats(stats *AtaStatistics) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.lastStats = stats
+    s.lastUpdate = time.Now()
+}
+
+func (s *statsManager) ParseAndUpdateStats(reader io.ReadCloser) (*driver.Update, error) {
+    var statistics AtaStatistics
+
+    var buf strings.Builder
+    tee := io.TeeReader(reader, &buf)
+
+    if err := json.NewDecoder(tee).Decode(&statistics); err != nil {
+        return nil, fmt.Errorf("while parsing '%.100v': %w", buf.String(), err)
+    }
+
+    log.Trace().
+        Interface("Stats", statistics).
+        Str("Raw", buf.String()).
+        Msg("ata: successfully parsed statistics")
+
+    s.updateStats(&statistics)
+
+    return &driver.Update{
+        NextCommunication: time.Time(statistics.NextCommunication),
+    }, nil
+}
+
+func (s *statsManager) RegisterMetrics(reg prometheus.Registerer, opts driver.CollectorOptions) {
+    RegisterCollector(s, reg, opts)
+}
+
+func (s *statsManager) Stats() (*AtaStatistics, time.Time) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    // Safe to unlock after returning the current value of the `lastStats` pointer as the
+    // stats object is never mutated, the pointer is just swapped around.
+    return s.lastStats, s.lastUpdate
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"rbf.dev/melcloud_prometheus_exporter/config"
 )
 
 const (
@@ -18,6 +20,9 @@ const (
     OperationModeLegionella
     OperationModeHoliday
     OperationModeProhibited
+    OperationModeDrying
+    OperationModeFan
+    OperationModeAuto
 )
 
 type OperationMode uint
@@ -34,6 +39,29 @@ func OperationModeHelpString() string {
     return "Available values: " + strings.Join(out, ", ")
 }
 
+// Time zone MELCloud timestamps are expressed in. MELCloud reports building-local times without
+// any zone information.
+var (
+    mitsubishiLocationMu sync.RWMutex
+    mitsubishiLocation = time.Local
+)
+
+// SetTimeZone sets the time zone used to interpret every MitsubishiTime parsed from now on.
+func SetTimeZone(loc *time.Location) {
+    mitsubishiLocationMu.Lock()
+    defer mitsubishiLocationMu.Unlock()
+
+    mitsubishiLocation = loc
+}
+
+// TimeZone returns the time zone used to interpret MELCloud timestamps.
+func TimeZone() *time.Location {
+    mitsubishiLocationMu.RLock()
+    defer mitsubishiLocationMu.RUnlock()
+
+    return mitsubishiLocation
+}
+
 type MitsubishiTime time.Time
 
 func (t *MitsubishiTime) UnmarshalJSON(b []byte) error {
@@ -42,7 +70,7 @@ func (t *MitsubishiTime) UnmarshalJSON(b []byte) error {
         return nil
     }
 
-    date, err := time.Parse("2006-01-02T15:04:05", value)
+    date, err := time.ParseInLocation("2006-01-02T15:04:05", value, TimeZone())
     if err != nil {
         return err
     }
@@ -57,7 +85,67 @@ type Update struct {
     NextCommunication time.Time
 }
 
+// Per-device options affecting how statistics are exported.
+type CollectorOptions struct {
+    // Statistics of devices which didn't communicate with MELCloud for longer than this are no
+    // longer exported. Zero disables the check.
+    MaxAge time.Duration
+    Timestamps config.TimestampMode
+}
+
+// SampleTime returns the timestamp to attach to samples according to the timestamp mode, or
+// the zero time if samples should carry no timestamp. When the last communication time is
+// requested but unknown, the last update time is used instead.
+func (opts CollectorOptions) SampleTime(lastUpdate, lastCommunication time.Time) time.Time {
+    switch opts.Timestamps {
+    case config.TimestampModeNone:
+        return time.Time{}
+    case config.TimestampModeLastCommunication:
+        if !lastCommunication.IsZero() {
+            return lastCommunication
+        }
+    }
+
+    return lastUpdate
+}
+
 type StatsManager interface {
     ParseAndUpdateStats(io.ReadCloser) (*Update, error)
-    RegisterMetrics(prometheus.Registerer)
+    RegisterMetrics(prometheus.Registerer, CollectorOptions)
+}
+
+// CollectFreshness sends the `stale` and `lastUpdate` indicators for statistics fetched at
+// `updated`, and returns whether the statistics are too old to be exported. Their age is
+// measured from the last time the device communicated with MELCloud, when known, as MELCloud
+// keeps serving the last known state of devices which went silent.
+func CollectFreshness(
+    ch chan<- prometheus.Metric,
+    stale, lastUpdate *prometheus.Desc,
+    updated, lastCommunication time.Time,
+    opts CollectorOptions,
+) bool {
+    age := time.Since(updated)
+    if !lastCommunication.IsZero() {
+        age = time.Since(lastCommunication)
+    }
+
+    isStale := opts.MaxAge > 0 && age > opts.MaxAge
+
+    value := 0.0
+    if isStale {
+        value = 1
+    }
+
+    ch <- prometheus.MustNewConstMetric(lastUpdate, prometheus.GaugeValue, float64(updated.UnixNano()) / 1e9)
+    ch <- prometheus.MustNewConstMetric(stale, prometheus.GaugeValue, value)
+
+    return isStale
+}
+
+// Retrieves the raw energy report covering the days between `from` and `to`, both inclusive.
+type EnergyReportFetcher func(from, to time.Time) (io.ReadCloser, error)
+
+// Optionally implemented by stats managers of devices which support MELCloud energy reports.
+type EnergyReportUpdater interface {
+    UpdateEnergyReport(EnergyReportFetcher) error
 }
@@ -0,0 +1,54 @@
+package ecodan
+
+import (
+    "time"
+)
+
+// Window over which the rolling coefficient of performance is computed.
+const rollingCOPWindow = 24 * time.Hour
+
+// Modes for which a coefficient of performance is derived.
+var copModes = []string{EnergyModeHeating, EnergyModeHotWater}
+
+type energySample struct {
+    Time time.Time
+    Totals map[string]EnergyValues
+}
+
+func cop(consumed, produced float64) (float64, bool) {
+    if consumed <= 0 {
+        return 0, false
+    }
+
+    return produced / consumed, true
+}
+
+// updateCOP records the current totals in the history and derives the daily and rolling
+// coefficients of performance. Modes which consumed no energy in the period are omitted.
+func (energy *EnergyStatistics) updateCOP(history []energySample, now time.Time) {
+    cutoff := now.Add(-rollingCOPWindow)
+
+    energy.history = make([]energySample, 0, len(history) + 1)
+    for _, sample := range history {
+        if !sample.Time.Before(cutoff) {
+            energy.history = append(energy.history, sample)
+        }
+    }
+    energy.history = append(energy.history, energySample{now, energy.Totals})
+
+    energy.DailyCOP = make(map[string]float64, len(copModes))
+    energy.RollingCOP = make(map[string]float64, len(copModes))
+    oldest := energy.history[0]
+
+    for _, mode := range copModes {
+        if value, ok := cop(energy.Today[mode].Consumed, energy.Today[mode].Produced); ok {
+            energy.DailyCOP[mode] = value
+        }
+
+        consumed := energy.Totals[mode].Consumed - oldest.Totals[mode].Consumed
+        produced := energy.Totals[mode].Produced - oldest.Totals[mode].Produced
+        if value, ok := cop(consumed, produced); ok {
+            energy.RollingCOP[mode] = value
+        }
+    }
+}
@@ -0,0 +1,147 @@
+package ecodan
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+const (
+    EnergyModeHeating = "heating"
+    EnergyModeCooling = "cooling"
+    EnergyModeHotWater = "hot_water"
+)
+
+var energyModes = []string{EnergyModeHeating, EnergyModeCooling, EnergyModeHotWater}
+
+type EnergyReport struct {
+    TotalHeatingConsumed, TotalHeatingProduced float64
+    TotalCoolingConsumed, TotalCoolingProduced float64
+    TotalHotWaterConsumed, TotalHotWaterProduced float64
+}
+
+type EnergyValues struct {
+    Consumed, Produced float64
+}
+
+func (report *EnergyReport) values() map[string]EnergyValues {
+    return map[string]EnergyValues{
+        EnergyModeHeating: {report.TotalHeatingConsumed, report.TotalHeatingProduced},
+        EnergyModeCooling: {report.TotalCoolingConsumed, report.TotalCoolingProduced},
+        EnergyModeHotWater: {report.TotalHotWaterConsumed, report.TotalHotWaterProduced},
+    }
+}
+
+type EnergyStatistics struct {
+    // Energy accumulated per mode since the exporter started, in kWh. Only ever increases.
+    Totals map[string]EnergyValues
+    // Energy reported per mode for `Day` so far, in kWh.
+    Today map[string]EnergyValues
+    Day time.Time
+
+    // Coefficient of performance per mode for `Day` so far, and over the rolling window.
+    DailyCOP, RollingCOP map[string]float64
+    history []energySample
+}
+
+func startOfDay(t time.Time) time.Time {
+    year, month, day := t.Date()
+    return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func fetchEnergyReport(fetch driver.EnergyReportFetcher, from, to time.Time) (*EnergyReport, error) {
+    reader, err := fetch(from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    defer reader.Close()
+
+    var report EnergyReport
+    if err := json.NewDecoder(reader).Decode(&report); err != nil {
+        return nil, fmt.Errorf("while decoding energy report: %w", err)
+    }
+
+    return &report, nil
+}
+
+// accumulate adds the energy reported in `current` on top of what was already accounted for in
+// `previous`. MELCloud occasionally revises daily figures downwards, which would otherwise
+// surface as a counter reset: in that case the highest value seen is retained.
+func (energy *EnergyStatistics) accumulate(previous, current map[string]EnergyValues) map[string]EnergyValues {
+    seen := make(map[string]EnergyValues, len(current))
+
+    for _, mode := range energyModes {
+        prev, cur, total := previous[mode], current[mode], energy.Totals[mode]
+
+        if delta := cur.Consumed - prev.Consumed; delta > 0 {
+            total.Consumed += delta
+        } else {
+            cur.Consumed = prev.Consumed
+        }
+
+        if delta := cur.Produced - prev.Produced; delta > 0 {
+            total.Produced += delta
+        } else {
+            cur.Produced = prev.Produced
+        }
+
+        energy.Totals[mode] = total
+        seen[mode] = cur
+    }
+
+    return seen
+}
+
+// nextEnergyStatistics fetches the energy reports required to move `previous` forward to the
+// current day. The first observation only establishes a baseline, so counters start from zero.
+func nextEnergyStatistics(previous *EnergyStatistics, fetch driver.EnergyReportFetcher, now time.Time) (*EnergyStatistics, error) {
+    today := startOfDay(now)
+
+    next := &EnergyStatistics{
+        Totals: make(map[string]EnergyValues, len(energyModes)),
+        Day: today,
+    }
+
+    if previous == nil {
+        report, err := fetchEnergyReport(fetch, today, today)
+        if err != nil {
+            return nil, err
+        }
+
+        next.Today = next.accumulate(report.values(), report.values())
+        next.updateCOP(nil, now)
+        return next, nil
+    }
+
+    for mode, values := range previous.Totals {
+        next.Totals[mode] = values
+    }
+
+    baseline := previous.Today
+
+    if previous.Day.Before(today) {
+        // The day rolled over since the last update: account for what was consumed between the
+        // last update and the end of the previous day(s), then start afresh.
+        yesterday := today.AddDate(0, 0, -1)
+        report, err := fetchEnergyReport(fetch, previous.Day, yesterday)
+        if err != nil {
+            return nil, err
+        }
+
+        next.accumulate(previous.Today, report.values())
+        baseline = nil
+    }
+
+    report, err := fetchEnergyReport(fetch, today, today)
+    if err != nil {
+        return nil, err
+    }
+
+    next.Today = next.accumulate(baseline, report.values())
+    next.updateCOP(previous.history, now)
+
+    return next, nil
+}
@@ -16,7 +16,7 @@ var (
   )
   descOperationModeZone = prometheus.NewDesc(
     "ecodan_zone_operation_mode",
-    "Operation mode for individual ECODan zones." + driver.OperationModeHelpString(),
+    "Operation mode for individual ECODan zones. " + driver.OperationModeHelpString(),
     []string{"zone_number"},
     nil,
   )
@@ -26,6 +26,30 @@ var (
     []string{"zone_number"},
     nil,
   )
+  descRoomTemperature = prometheus.NewDesc(
+    "ecodan_zone_room_temperature_celsius",
+    "Room temperature for individual ECODan zones.",
+    []string{"zone_number"},
+    nil,
+  )
+  descRoomTemperatureSetpoint = prometheus.NewDesc(
+    "ecodan_zone_room_temperature_setpoint_celsius",
+    "Room temperature setpoint for individual ECODan zones.",
+    []string{"zone_number"},
+    nil,
+  )
+  descFlowTemperature = prometheus.NewDesc(
+    "ecodan_flow_temperature_celsius",
+    "Flow temperature for the ECODan.",
+    nil,
+    nil,
+  )
+  descReturnTemperature = prometheus.NewDesc(
+    "ecodan_return_temperature_celsius",
+    "Return temperature for the ECODan.",
+    nil,
+    nil,
+  )
   descTankWaterTemperatureSetpoint = prometheus.NewDesc(
     "ecodan_tank_temperature_setpoint_celsius",
     "Tank temperature setpoint for the ECODan.",
@@ -62,26 +86,81 @@ var (
     nil,
     nil,
   )
+  descEnergyConsumed = prometheus.NewDesc(
+    "ecodan_energy_consumed_kwh_total",
+    "Energy consumed by the ECODan per mode since the exporter started, from MELCloud energy reports.",
+    []string{"mode"},
+    nil,
+  )
+  descEnergyProduced = prometheus.NewDesc(
+    "ecodan_energy_produced_kwh_total",
+    "Energy produced by the ECODan per mode since the exporter started, from MELCloud energy reports.",
+    []string{"mode"},
+    nil,
+  )
+  descDailyCOP = prometheus.NewDesc(
+    "ecodan_daily_cop",
+    "Coefficient of performance of the ECODan per mode for the current day.",
+    []string{"mode"},
+    nil,
+  )
+  descRollingCOP = prometheus.NewDesc(
+    "ecodan_rolling_cop",
+    "Coefficient of performance of the ECODan per mode over the last 24 hours (or since the exporter started, if more recent).",
+    []string{"mode"},
+    nil,
+  )
+  descLastCommunication = prometheus.NewDesc(
+    "ecodan_last_communication_timestamp_seconds",
+    "Unix timestamp of the last communication between the ECODan and MELCloud.",
+    nil,
+    nil,
+  )
+  descStale = prometheus.NewDesc(
+    "ecodan_stale",
+    "Whether the ECODan last communicated with MELCloud longer ago than the configured max age, in which case its statistics are not exported.",
+    nil,
+    nil,
+  )
+  descLastUpdate = prometheus.NewDesc(
+    "ecodan_last_update_timestamp_seconds",
+    "Unix timestamp of the last statistics update for the ECODan.",
+    nil,
+    nil,
+  )
   allDescriptors = []*prometheus.Desc{
     descOperationMode,
     descOperationModeZone,
     descHeatFlowTemperatureSetpoint,
+    descRoomTemperature,
+    descRoomTemperatureSetpoint,
+    descFlowTemperature,
+    descReturnTemperature,
     descTankWaterTemperatureSetpoint,
     descTankWaterTemperature,
     descForcedHotWater,
     descOutdoorTemperature,
     descPower,
     descOffline,
+    descLastCommunication,
+    descStale,
+    descLastUpdate,
+    descEnergyConsumed,
+    descEnergyProduced,
+    descDailyCOP,
+    descRollingCOP,
   }
 
 )
 
 type StatsProvider interface {
   Stats() (*EcodanStatistics, time.Time)
+  Energy() (*EnergyStatistics, time.Time)
 }
 
 type collector struct {
   provider StatsProvider
+  opts driver.CollectorOptions
 }
 
 func toBool(v bool) float64 {
@@ -92,6 +171,10 @@ func toBool(v bool) float64 {
 }
 
 func sendWithTimestamp(ch chan<- prometheus.Metric, t time.Time, m prometheus.Metric) {
+  if t.IsZero() {
+    ch <- m
+    return
+  }
   ch <- prometheus.NewMetricWithTimestamp(t, m)
 }
 
@@ -108,18 +191,64 @@ func (collector collector) Collect(ch chan<- prometheus.Metric) {
     return
   }
 
+  if driver.CollectFreshness(ch, descStale, descLastUpdate, t, time.Time(stats.LastCommunication), collector.opts) {
+    return
+  }
+
+  collector.collectEnergy(ch)
+
+  t = collector.opts.SampleTime(t, time.Time(stats.LastCommunication))
+
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOperationMode, prometheus.GaugeValue, float64(stats.OperationMode)))
-  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOperationModeZone, prometheus.GaugeValue, float64(stats.OperationModeZone1), "1"))
-  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descHeatFlowTemperatureSetpoint, prometheus.GaugeValue, float64(stats.SetHeatFlowTemperatureZone1), "1"))
+
+  for _, zone := range stats.Zones() {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOperationModeZone, prometheus.GaugeValue, float64(zone.OperationMode), zone.Number))
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descHeatFlowTemperatureSetpoint, prometheus.GaugeValue, float64(zone.SetHeatFlowTemperature), zone.Number))
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descRoomTemperature, prometheus.GaugeValue, float64(zone.RoomTemperature), zone.Number))
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descRoomTemperatureSetpoint, prometheus.GaugeValue, float64(zone.SetRoomTemperature), zone.Number))
+  }
+
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFlowTemperature, prometheus.GaugeValue, float64(stats.FlowTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descReturnTemperature, prometheus.GaugeValue, float64(stats.ReturnTemperature)))
+
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descTankWaterTemperatureSetpoint, prometheus.GaugeValue, float64(stats.SetTankWaterTemperature)))
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descTankWaterTemperature, prometheus.GaugeValue, float64(stats.TankWaterTemperature)))
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descForcedHotWater, prometheus.GaugeValue, toBool(stats.ForcedHotWaterMode)))
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOutdoorTemperature, prometheus.GaugeValue, float64(stats.OutdoorTemperature)))
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descPower, prometheus.GaugeValue, toBool(stats.Power)))
   sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOffline, prometheus.GaugeValue, toBool(stats.Offline)))
+
+  if lastCommunication := time.Time(stats.LastCommunication); !lastCommunication.IsZero() {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descLastCommunication, prometheus.GaugeValue, float64(lastCommunication.Unix())))
+  }
+}
+
+func (collector collector) collectEnergy(ch chan<- prometheus.Metric) {
+  energy, t := collector.provider.Energy()
+
+  if energy == nil {
+    return
+  }
+
+  t = collector.opts.SampleTime(t, time.Time{})
+
+  for _, mode := range energyModes {
+    values := energy.Totals[mode]
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descEnergyConsumed, prometheus.CounterValue, values.Consumed, mode))
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descEnergyProduced, prometheus.CounterValue, values.Produced, mode))
+  }
+
+  for _, mode := range copModes {
+    if value, ok := energy.DailyCOP[mode]; ok {
+      sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descDailyCOP, prometheus.GaugeValue, value, mode))
+    }
+    if value, ok := energy.RollingCOP[mode]; ok {
+      sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descRollingCOP, prometheus.GaugeValue, value, mode))
+    }
+  }
 }
 
-func RegisterCollector(provider StatsProvider, reg prometheus.Registerer) {
-  collector := collector{provider}
+func RegisterCollector(provider StatsProvider, reg prometheus.Registerer, opts driver.CollectorOptions) {
+  collector := collector{provider, opts}
   reg.MustRegister(collector)
 }
@@ -9,10 +9,22 @@ import (
 type EcodanStatistics struct {
     OperationMode driver.OperationMode `json:"-"`
     OperationModeZone1 driver.OperationMode `json:"-"`
+    OperationModeZone2 driver.OperationMode `json:"-"`
 
     SetHeatFlowTemperatureZone1 float32
+    RoomTemperatureZone1 float32
+    SetTemperatureZone1 float32
     ProhibitZone1 bool
 
+    HasZone2 bool
+    SetHeatFlowTemperatureZone2 float32
+    RoomTemperatureZone2 float32
+    SetTemperatureZone2 float32
+    ProhibitZone2 bool
+
+    FlowTemperature float32
+    ReturnTemperature float32
+
     SetTankWaterTemperature float32
     TankWaterTemperature float32
     ProhibitHotWater bool
@@ -25,39 +37,80 @@ type EcodanStatistics struct {
 
     RawOperationMode int `json:"OperationMode"`
     RawOperationModeZone1 int `json:"OperationModeZone1"`
+    RawOperationModeZone2 int `json:"OperationModeZone2"`
+}
+
+// Per-zone view of the statistics.
+type ZoneStatistics struct {
+    Number string
+    OperationMode driver.OperationMode
+    SetHeatFlowTemperature float32
+    RoomTemperature float32
+    SetRoomTemperature float32
+}
+
+// Zones returns the statistics for each zone present on the unit.
+func (stats *EcodanStatistics) Zones() []ZoneStatistics {
+    zones := []ZoneStatistics{{
+        Number: "1",
+        OperationMode: stats.OperationModeZone1,
+        SetHeatFlowTemperature: stats.SetHeatFlowTemperatureZone1,
+        RoomTemperature: stats.RoomTemperatureZone1,
+        SetRoomTemperature: stats.SetTemperatureZone1,
+    }}
+
+    if stats.HasZone2 {
+        zones = append(zones, ZoneStatistics{
+            Number: "2",
+            OperationMode: stats.OperationModeZone2,
+            SetHeatFlowTemperature: stats.SetHeatFlowTemperatureZone2,
+            RoomTemperature: stats.RoomTemperatureZone2,
+            SetRoomTemperature: stats.SetTemperatureZone2,
+        })
+    }
+
+    return zones
+}
+
+func zoneOperationMode(opMode, zoneOpMode int, prohibit bool) driver.OperationMode {
+    if prohibit {
+        return driver.OperationModeProhibited
+    } else if opMode == 2 {
+        if zoneOpMode == 5 {
+            return driver.OperationModeDryFloor
+        } else {
+            return driver.OperationModeHeating
+        }
+    } else if opMode == 5 {
+        return driver.OperationModeAntiFreeze
+    } else if opMode == 3 {
+        return driver.OperationModeCooling
+    } else {
+        return driver.OperationModeIdle
+    }
 }
 
 func (stats *EcodanStatistics) UnmarshalJSON(b []byte) error {
-    type rawStats *EcodanStatistics
-    if err := json.Unmarshal(b, rawStats(stats)); err != nil {
+    type rawStats EcodanStatistics
+    if err := json.Unmarshal(b, (*rawStats)(stats)); err != nil {
         return err
     }
 
     // Adapt operation mode.
-    opMode, zone1OpMode := stats.RawOperationMode, stats.RawOperationModeZone1
+    opMode := stats.RawOperationMode
 
     func() {
         if stats.HolidayMode {
             stats.OperationMode = driver.OperationModeHoliday
             stats.OperationModeZone1 = driver.OperationModeHoliday
+            stats.OperationModeZone2 = driver.OperationModeHoliday
             return
         }
 
-        // Zone 1
-        if stats.ProhibitZone1 {
-            stats.OperationModeZone1 = driver.OperationModeProhibited
-        } else if opMode == 2 {
-            if zone1OpMode == 5 {
-                stats.OperationModeZone1 = driver.OperationModeDryFloor
-            } else {
-                stats.OperationModeZone1 = driver.OperationModeHeating
-            }
-        } else if opMode == 5 {
-            stats.OperationModeZone1 = driver.OperationModeAntiFreeze
-        } else if opMode == 3 {
-            stats.OperationModeZone1 = driver.OperationModeCooling
-        } else {
-            stats.OperationModeZone1 = driver.OperationModeIdle
+        // Zones
+        stats.OperationModeZone1 = zoneOperationMode(opMode, stats.RawOperationModeZone1, stats.ProhibitZone1)
+        if stats.HasZone2 {
+            stats.OperationModeZone2 = zoneOperationMode(opMode, stats.RawOperationModeZone2, stats.ProhibitZone2)
         }
 
         // Hot water
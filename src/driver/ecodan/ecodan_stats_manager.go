@@ -10,13 +10,29 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"rbf.dev/melcloud_prometheus_exporter/config"
 	"rbf.dev/melcloud_prometheus_exporter/driver"
+	"rbf.dev/melcloud_prometheus_exporter/melcloud"
 )
 
+const DeviceType config.DeviceType = "ecodan"
+
+func init() {
+    driver.Register(driver.Factory{
+        Type: DeviceType,
+        Description: "Ecodan air-to-water heat pumps",
+        MELCloudTypes: []melcloud.DeviceType{melcloud.DeviceTypeATW},
+        New: NewDefaultStatsManager,
+        Validate: driver.ValidateDeviceLocation,
+    })
+}
+
 type statsManager struct {
     mu sync.RWMutex
     lastStats *EcodanStatistics
     lastUpdate time.Time
+    lastEnergy *EnergyStatistics
+    lastEnergyUpdate time.Time
 }
 
 func NewDefaultStatsManager() driver.StatsManager {
@@ -53,8 +69,30 @@ func (s *statsManager) ParseAndUpdateStats(reader io.ReadCloser) (*driver.Update
     }, nil
 }
 
-func (s *statsManager) RegisterMetrics(reg prometheus.Registerer) {
-    RegisterCollector(s, reg)
+func (s *statsManager) UpdateEnergyReport(fetch driver.EnergyReportFetcher) error {
+    previous, _ := s.Energy()
+
+    // Energy reports are split into days according to the building-local time.
+    energy, err := nextEnergyStatistics(previous, fetch, time.Now().In(driver.TimeZone()))
+    if err != nil {
+        return err
+    }
+
+    log.Trace().
+        Interface("Energy", energy).
+        Msg("ecodan: successfully updated energy statistics")
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.lastEnergy = energy
+    s.lastEnergyUpdate = time.Now()
+
+    return nil
+}
+
+func (s *statsManager) RegisterMetrics(reg prometheus.Registerer, opts driver.CollectorOptions) {
+    RegisterCollector(s, reg, opts)
 }
 
 func (s *statsManager) Stats() (*EcodanStatistics, time.Time) {
@@ -65,3 +103,11 @@ func (s *statsManager) Stats() (*EcodanStatistics, time.Time) {
     // stats object is never mutated, the pointer is just swapped around.
     return s.lastStats, s.lastUpdate
 }
+
+func (s *statsManager) Energy() (*EnergyStatistics, time.Time) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    // Same as above, energy statistics are never mutated once published.
+    return s.lastEnergy, s.lastEnergyUpdate
+}
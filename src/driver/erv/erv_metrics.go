@@ -0,0 +1,195 @@
+package erv
+
+import (
+  "time"
+
+  "github.com/prometheus/client_golang/prometheus"
+  "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+var (
+  descRoomTemperature = prometheus.NewDesc(
+    "erv_room_temperature_celsius",
+    "Room temperature measured by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descOutdoorTemperature = prometheus.NewDesc(
+    "erv_outdoor_temperature_celsius",
+    "Outdoor temperature measured by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descSupplyTemperature = prometheus.NewDesc(
+    "erv_supply_temperature_celsius",
+    "Temperature of the air supplied by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descExhaustTemperature = prometheus.NewDesc(
+    "erv_exhaust_temperature_celsius",
+    "Temperature of the air exhausted by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descVentilationMode = prometheus.NewDesc(
+    "erv_ventilation_mode",
+    "Ventilation mode of the ventilation unit. Available values: 0 (Recovery), 1 (Bypass), 2 (Auto)",
+    []string{"kind"},
+    nil,
+  )
+  descFanSpeed = prometheus.NewDesc(
+    "erv_fan_speed",
+    "Fan speed of the ventilation unit. 0 means automatic.",
+    []string{"fan"},
+    nil,
+  )
+  descFanSpeedCount = prometheus.NewDesc(
+    "erv_fan_speeds",
+    "Number of fan speeds supported by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descCO2Level = prometheus.NewDesc(
+    "erv_room_co2_ppm",
+    "Room CO2 level measured by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descPM25Level = prometheus.NewDesc(
+    "erv_pm25_micrograms_per_cubic_meter",
+    "PM2.5 level measured by the ventilation unit.",
+    nil,
+    nil,
+  )
+  descMaintenanceRequired = prometheus.NewDesc(
+    "erv_maintenance_required",
+    "Whether the ventilation unit reports that a component needs maintenance.",
+    []string{"component"},
+    nil,
+  )
+  descPower = prometheus.NewDesc(
+    "erv_power_on",
+    "Power state of the ventilation unit.",
+    nil,
+    nil,
+  )
+  descOffline = prometheus.NewDesc(
+    "erv_offline",
+    "Whether the ventilation unit is offline.",
+    nil,
+    nil,
+  )
+  descLastCommunication = prometheus.NewDesc(
+    "erv_last_communication_timestamp_seconds",
+    "Unix timestamp of the last communication between the ventilation unit and MELCloud.",
+    nil,
+    nil,
+  )
+  descStale = prometheus.NewDesc(
+    "erv_stale",
+    "Whether the ventilation unit last communicated with MELCloud longer ago than the configured max age, in which case its statistics are not exported.",
+    nil,
+    nil,
+  )
+  descLastUpdate = prometheus.NewDesc(
+    "erv_last_update_timestamp_seconds",
+    "Unix timestamp of the last statistics update for the ventilation unit.",
+    nil,
+    nil,
+  )
+  allDescriptors = []*prometheus.Desc{
+    descRoomTemperature,
+    descOutdoorTemperature,
+    descSupplyTemperature,
+    descExhaustTemperature,
+    descVentilationMode,
+    descFanSpeed,
+    descFanSpeedCount,
+    descCO2Level,
+    descPM25Level,
+    descMaintenanceRequired,
+    descPower,
+    descOffline,
+    descLastCommunication,
+    descStale,
+    descLastUpdate,
+  }
+)
+
+type StatsProvider interface {
+  Stats() (*ErvStatistics, time.Time)
+}
+
+type collector struct {
+  provider StatsProvider
+  opts driver.CollectorOptions
+}
+
+func toBool(v bool) float64 {
+  if v {
+    return 1
+  }
+  return 0
+}
+
+func sendWithTimestamp(ch chan<- prometheus.Metric, t time.Time, m prometheus.Metric) {
+  if t.IsZero() {
+    ch <- m
+    return
+  }
+  ch <- prometheus.NewMetricWithTimestamp(t, m)
+}
+
+func (collector collector) Describe(ch chan<- *prometheus.Desc) {
+  for _, desc := range allDescriptors {
+    ch <- desc
+  }
+}
+
+func (collector collector) Collect(ch chan<- prometheus.Metric) {
+  stats, t := collector.provider.Stats()
+
+  if stats == nil {
+    return
+  }
+
+  if driver.CollectFreshness(ch, descStale, descLastUpdate, t, time.Time(stats.LastCommunication), collector.opts) {
+    return
+  }
+
+  t = collector.opts.SampleTime(t, time.Time(stats.LastCommunication))
+
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descRoomTemperature, prometheus.GaugeValue, float64(stats.RoomTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOutdoorTemperature, prometheus.GaugeValue, float64(stats.OutdoorTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descSupplyTemperature, prometheus.GaugeValue, float64(stats.SupplyTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descExhaustTemperature, prometheus.GaugeValue, float64(stats.ExhaustTemperature)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descVentilationMode, prometheus.GaugeValue, float64(stats.VentilationMode), "set"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descVentilationMode, prometheus.GaugeValue, float64(stats.ActualVentilationMode), "actual"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeed, prometheus.GaugeValue, float64(stats.SetFanSpeed), "set"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeed, prometheus.GaugeValue, float64(stats.ActualSupplyFanSpeed), "supply"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeed, prometheus.GaugeValue, float64(stats.ActualExhaustFanSpeed), "exhaust"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descFanSpeedCount, prometheus.GaugeValue, float64(stats.NumberOfFanSpeeds)))
+
+  // Air quality readings are only meaningful when the unit has the corresponding sensor.
+  if stats.HasCO2Sensor {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descCO2Level, prometheus.GaugeValue, float64(stats.RoomCO2Level)))
+  }
+  if stats.HasPM25Sensor {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descPM25Level, prometheus.GaugeValue, float64(stats.PM25Level)))
+  }
+
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descMaintenanceRequired, prometheus.GaugeValue, toBool(stats.FilterMaintenanceRequired), "filter"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descMaintenanceRequired, prometheus.GaugeValue, toBool(stats.CoreMaintenanceRequired), "core"))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descPower, prometheus.GaugeValue, toBool(stats.Power)))
+  sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descOffline, prometheus.GaugeValue, toBool(stats.Offline)))
+
+  if lastCommunication := time.Time(stats.LastCommunication); !lastCommunication.IsZero() {
+    sendWithTimestamp(ch, t, prometheus.MustNewConstMetric(descLastCommunication, prometheus.GaugeValue, float64(lastCommunication.Unix())))
+  }
+}
+
+func RegisterCollector(provider StatsProvider, reg prometheus.Registerer, opts driver.CollectorOptions) {
+  collector := collector{provider, opts}
+  reg.MustRegister(collector)
+}
@@ -0,0 +1,41 @@
+package erv
+
+import (
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+const (
+    VentilationModeRecovery = 0
+    VentilationModeBypass = 1
+    VentilationModeAuto = 2
+)
+
+type ErvStatistics struct {
+    RoomTemperature float32
+    OutdoorTemperature float32
+    SupplyTemperature float32
+    ExhaustTemperature float32
+
+    // One of the VentilationMode* constants. When set to auto, the mode the unit actually
+    // picked is reported in ActualVentilationMode.
+    VentilationMode int
+    ActualVentilationMode int
+
+    // 0 means automatic, otherwise 1..NumberOfFanSpeeds.
+    SetFanSpeed int
+    NumberOfFanSpeeds int
+    ActualSupplyFanSpeed int
+    ActualExhaustFanSpeed int
+
+    HasCO2Sensor bool
+    RoomCO2Level int
+    HasPM25Sensor bool
+    PM25Level int
+
+    FilterMaintenanceRequired bool
+    CoreMaintenanceRequired bool
+
+    LastCommunication driver.MitsubishiTime
+    NextCommunication driver.MitsubishiTime
+    Power, Offline bool
+}
@@ -7,11 +7,11 @@ import (
 	"strings"
 )
 
-const _OperationModeName = "OperationModeDryFloorOperationModeHeatingOperationModeAntiFreezeOperationModeCoolingOperationModeIdleOperationModeLegionellaOperationModeHolidayOperationModeProhibited"
+const _OperationModeName = "OperationModeDryFloorOperationModeHeatingOperationModeAntiFreezeOperationModeCoolingOperationModeIdleOperationModeLegionellaOperationModeHolidayOperationModeProhibitedOperationModeDryingOperationModeFanOperationModeAuto"
 
-var _OperationModeIndex = [...]uint8{0, 21, 41, 64, 84, 101, 124, 144, 167}
+var _OperationModeIndex = [...]uint8{0, 21, 41, 64, 84, 101, 124, 144, 167, 186, 202, 219}
 
-const _OperationModeLowerName = "operationmodedryflooroperationmodeheatingoperationmodeantifreezeoperationmodecoolingoperationmodeidleoperationmodelegionellaoperationmodeholidayoperationmodeprohibited"
+const _OperationModeLowerName = "operationmodedryflooroperationmodeheatingoperationmodeantifreezeoperationmodecoolingoperationmodeidleoperationmodelegionellaoperationmodeholidayoperationmodeprohibitedoperationmodedryingoperationmodefanoperationmodeauto"
 
 func (i OperationMode) String() string {
 	if i >= OperationMode(len(_OperationModeIndex)-1) {
@@ -32,9 +32,12 @@ func _OperationModeNoOp() {
 	_ = x[OperationModeLegionella-(5)]
 	_ = x[OperationModeHoliday-(6)]
 	_ = x[OperationModeProhibited-(7)]
+	_ = x[OperationModeDrying-(8)]
+	_ = x[OperationModeFan-(9)]
+	_ = x[OperationModeAuto-(10)]
 }
 
-var _OperationModeValues = []OperationMode{OperationModeDryFloor, OperationModeHeating, OperationModeAntiFreeze, OperationModeCooling, OperationModeIdle, OperationModeLegionella, OperationModeHoliday, OperationModeProhibited}
+var _OperationModeValues = []OperationMode{OperationModeDryFloor, OperationModeHeating, OperationModeAntiFreeze, OperationModeCooling, OperationModeIdle, OperationModeLegionella, OperationModeHoliday, OperationModeProhibited, OperationModeDrying, OperationModeFan, OperationModeAuto}
 
 var _OperationModeNameToValueMap = map[string]OperationMode{
 	_OperationModeName[0:21]:         OperationModeDryFloor,
@@ -53,6 +56,12 @@ var _OperationModeNameToValueMap = map[string]OperationMode{
 	_OperationModeLowerName[124:144]: OperationModeHoliday,
 	_OperationModeName[144:167]:      OperationModeProhibited,
 	_OperationModeLowerName[144:167]: OperationModeProhibited,
+	_OperationModeName[167:186]:      OperationModeDrying,
+	_OperationModeLowerName[167:186]: OperationModeDrying,
+	_OperationModeName[186:202]:      OperationModeFan,
+	_OperationModeLowerName[186:202]: OperationModeFan,
+	_OperationModeName[202:219]:      OperationModeAuto,
+	_OperationModeLowerName[202:219]: OperationModeAuto,
 }
 
 var _OperationModeNames = []string{
@@ -64,6 +73,9 @@ var _OperationModeNames = []string{
 	_OperationModeName[101:124],
 	_OperationModeName[124:144],
 	_OperationModeName[144:167],
+	_OperationModeName[167:186],
+	_OperationModeName[186:202],
+	_OperationModeName[202:219],
 }
 
 // OperationModeString retrieves an enum value from the enum constants string name.
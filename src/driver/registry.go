@@ -0,0 +1,130 @@
+package driver
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+// Factory describes a driver which can be instantiated for devices of a given type.
+type Factory struct {
+    // Device type, as referenced by the `Type` field of the device descriptors in the config.
+    Type config.DeviceType
+    // Human readable description, shown in the usage string.
+    Description string
+    // MELCloud device types handled by this driver, used to match discovered devices.
+    MELCloudTypes []melcloud.DeviceType
+    New func() StatsManager
+    // Optional validation of the device descriptor, run before the driver is instantiated.
+    Validate func(config.MELCloudDeviceDescriptor) error
+}
+
+var (
+    factoriesMu sync.RWMutex
+    factories = make(map[config.DeviceType]Factory)
+)
+
+// Register makes a driver available for the given device type. It is meant to be called from
+// the `init` function of driver packages, and panics if the type is already registered.
+func Register(factory Factory) {
+    factoriesMu.Lock()
+    defer factoriesMu.Unlock()
+
+    if factory.New == nil {
+        panic(fmt.Sprintf("driver: Register called with nil constructor for type '%v'", factory.Type))
+    }
+
+    if _, ok := factories[factory.Type]; ok {
+        panic(fmt.Sprintf("driver: Register called twice for type '%v'", factory.Type))
+    }
+
+    factories[factory.Type] = factory
+}
+
+// Lookup returns the factory registered for the given device type.
+func Lookup(deviceType config.DeviceType) (Factory, bool) {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    factory, ok := factories[deviceType]
+    return factory, ok
+}
+
+// Factories returns all the registered factories, sorted by device type.
+func Factories() []Factory {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    out := make([]Factory, 0, len(factories))
+    for _, factory := range factories {
+        out = append(out, factory)
+    }
+
+    sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+
+    return out
+}
+
+// LookupMELCloudType returns the factory handling devices of the given MELCloud type.
+func LookupMELCloudType(melcloudType melcloud.DeviceType) (Factory, bool) {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    for _, factory := range factories {
+        for _, t := range factory.MELCloudTypes {
+            if t == melcloudType {
+                return factory, true
+            }
+        }
+    }
+
+    return Factory{}, false
+}
+
+// ValidateDescriptor checks that a driver is registered for the type of the device descriptor
+// and that the driver accepts it.
+func ValidateDescriptor(descriptor config.MELCloudDeviceDescriptor) error {
+    if descriptor.Type == "" {
+        return fmt.Errorf("missing device Type")
+    }
+
+    factory, ok := Lookup(descriptor.Type)
+    if !ok {
+        return fmt.Errorf("unknown device type '%v'", descriptor.Type)
+    }
+
+    if factory.Validate != nil {
+        if err := factory.Validate(descriptor); err != nil {
+            return fmt.Errorf("invalid '%v' device: %w", descriptor.Type, err)
+        }
+    }
+
+    return nil
+}
+
+// NewStatsManager validates the device descriptor and instantiates the driver for its type.
+func NewStatsManager(descriptor config.MELCloudDeviceDescriptor) (StatsManager, error) {
+    if err := ValidateDescriptor(descriptor); err != nil {
+        return nil, err
+    }
+
+    factory, _ := Lookup(descriptor.Type)
+    return factory.New(), nil
+}
+
+// ValidateDeviceLocation checks that the descriptor carries the identifiers required to query
+// the device information from MELCloud.
+func ValidateDeviceLocation(descriptor config.MELCloudDeviceDescriptor) error {
+    if descriptor.Id == "" {
+        return fmt.Errorf("missing device Id")
+    }
+
+    if descriptor.BuildingId == "" {
+        return fmt.Errorf("missing device BuildingId")
+    }
+
+    return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+    "errors"
+    "sync"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+
+    "rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+// Reasons used to classify fetch failures.
+const (
+    failureRateLimited = "rate_limited"
+    failureAuth = "auth"
+    failureDecode = "decode"
+    // MELCloud answered with a 5xx status code.
+    failureServer = "server"
+    // MELCloud answered with any other unexpected status code.
+    failureHTTP = "http"
+    failureNetwork = "network"
+)
+
+var (
+    upGauge = prometheus.NewGauge(
+        prometheus.GaugeOpts{
+            Name: "up",
+            Help: "Whether the last fetch of at least one device from MELCloud succeeded.",
+        },
+    )
+    fetchAttempts = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "exporter_fetch_attempts_total",
+            Help: "Number of attempts to fetch statistics from MELCloud per device.",
+        },
+        []string{"device"},
+    )
+    fetchFailures = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "exporter_fetch_failures_total",
+            Help: "Number of failed attempts to fetch statistics from MELCloud per device and reason.",
+        },
+        []string{"device", "reason"},
+    )
+    fetchDuration = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name: "exporter_fetch_duration_seconds",
+            Help: "Time taken to fetch and decode statistics from MELCloud per device.",
+            Buckets: prometheus.ExponentialBuckets(0.1, 2, 9),
+        },
+        []string{"device"},
+    )
+    energyReportFailures = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "exporter_energy_report_failures_total",
+            Help: "Number of failed attempts to update the energy report from MELCloud per device and reason.",
+        },
+        []string{"device", "reason"},
+    )
+    lastSuccessfulFetch = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "exporter_last_successful_fetch_timestamp_seconds",
+            Help: "Unix timestamp of the last successful statistics fetch per device.",
+        },
+        []string{"device"},
+    )
+    backoffFactorGauge = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "exporter_backoff_factor",
+            Help: "Current backoff factor per device: 1 when healthy, increasing with each consecutive failed fetch until the maximum backoff is reached.",
+        },
+        []string{"device"},
+    )
+
+    nextPollMu sync.Mutex
+    nextPoll time.Time
+)
+
+func registerExporterMetrics(reg prometheus.Registerer) {
+    reg.MustRegister(
+        upGauge,
+        fetchAttempts,
+        fetchFailures,
+        fetchDuration,
+        energyReportFailures,
+        lastSuccessfulFetch,
+        backoffFactorGauge,
+        prometheus.NewGaugeFunc(
+            prometheus.GaugeOpts{
+                Name: "exporter_next_poll_seconds",
+                Help: "Time until the next scheduled statistics fetch, across all devices.",
+            },
+            func() float64 {
+                nextPollMu.Lock()
+                defer nextPollMu.Unlock()
+
+                if until := time.Until(nextPoll); until > 0 {
+                    return until.Seconds()
+                }
+                return 0
+            },
+        ),
+    )
+}
+
+// registerRequestorMetrics registers the metrics which depend on the MELCloud requestor, once
+// it's available.
+func registerRequestorMetrics(reg prometheus.Registerer, requestor *melcloud.MelcloudRequestor) {
+    reg.MustRegister(prometheus.NewCounterFunc(
+        prometheus.CounterOpts{
+            Name: "exporter_reauthentications_total",
+            Help: "Number of times the MELCloud session was renewed after expiring.",
+        },
+        func() float64 { return float64(requestor.Reauthentications()) },
+    ))
+
+    if limiter := requestor.RateLimiter(); limiter != nil {
+        reg.MustRegister(prometheus.NewGaugeFunc(
+            prometheus.GaugeOpts{
+                Name: "exporter_rate_limit_remaining_requests",
+                Help: "Number of MELCloud requests which can currently be issued without waiting for the rate limiter.",
+            },
+            limiter.Remaining,
+        ))
+    }
+}
+
+func setNextPoll(t time.Time) {
+    nextPollMu.Lock()
+    defer nextPollMu.Unlock()
+
+    nextPoll = t
+}
+
+// fetchFailureReason classifies errors returned by MELCloud requests.
+func fetchFailureReason(err error) string {
+    var statusErr *melcloud.StatusError
+
+    switch {
+    case errors.Is(err, melcloud.ErrTooManyRequests):
+        return failureRateLimited
+    case errors.Is(err, melcloud.ErrUnauthorized):
+        return failureAuth
+    case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+        return failureServer
+    case errors.As(err, &statusErr):
+        return failureHTTP
+    default:
+        return failureNetwork
+    }
+}
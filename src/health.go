@@ -0,0 +1,76 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+var (
+    // Scheduler polling the devices, set once MELCloud could be reached.
+    activeSchedulerMu sync.RWMutex
+    activeScheduler *scheduler
+)
+
+func setActiveScheduler(s *scheduler) {
+    activeSchedulerMu.Lock()
+    defer activeSchedulerMu.Unlock()
+
+    activeScheduler = s
+}
+
+func getActiveScheduler() *scheduler {
+    activeSchedulerMu.RLock()
+    defer activeSchedulerMu.RUnlock()
+
+    return activeScheduler
+}
+
+type deviceStatus struct {
+    Healthy bool `json:"healthy"`
+    LastSuccessfulFetch *time.Time `json:"lastSuccessfulFetch,omitempty"`
+    NextPoll time.Time `json:"nextPoll"`
+}
+
+type readiness struct {
+    Ready bool `json:"ready"`
+    Authenticated bool `json:"authenticated"`
+    Devices map[string]deviceStatus `json:"devices"`
+}
+
+// healthz reports that the process is alive.
+func healthz(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.Write([]byte("ok\n"))
+}
+
+// readyz reports whether the exporter is authenticated with MELCloud and fetched at least one
+// device successfully within `window`, with per-device details.
+func readyz(window time.Duration) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        status := readiness{Devices: map[string]deviceStatus{}}
+
+        if s := getActiveScheduler(); s != nil {
+            status.Authenticated = s.requestor.Authenticated()
+            status.Devices = s.status()
+
+            for _, device := range status.Devices {
+                if device.LastSuccessfulFetch != nil && time.Since(*device.LastSuccessfulFetch) <= window {
+                    status.Ready = status.Authenticated
+                }
+            }
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        if !status.Ready {
+            w.WriteHeader(http.StatusServiceUnavailable)
+        }
+
+        if err := json.NewEncoder(w).Encode(status); err != nil {
+            log.Debug().Err(err).Msg("Unable to write readiness status")
+        }
+    }
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "strconv"
+    "text/tabwriter"
+
+    "github.com/rs/zerolog/log"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+// listDevices implements the `list-devices` subcommand, printing every device on the account.
+// With `--json`, the devices are printed as descriptors in the format expected by the `Devices`
+// section of the config instead, with unique labels derived from their names.
+func listDevices(args []string) {
+    flags := flag.NewFlagSet("list-devices", flag.ExitOnError)
+    asJSON := flags.Bool("json", false, "print devices as config descriptors in JSON")
+    flags.Usage = func() {
+        fmt.Fprintf(flags.Output(), "Usage: %v list-devices [flags] <config-path>\n\nFlags:\n", os.Args[0])
+        flags.PrintDefaults()
+    }
+    flags.Parse(args)
+
+    if flags.NArg() < 1 {
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    cfg, err := loadConfig(flags.Arg(0))
+    if err != nil {
+        log.Fatal().Err(err).Msg("Unable to load config")
+    }
+
+    requestor, err := authenticate(context.Background(), cfg.MELCloudConfig)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Unable to authenticate with MELCloud")
+    }
+
+    devices, err := requestor.ListDevices(context.Background())
+    if err != nil {
+        log.Fatal().Err(err).Msg("Unable to list devices")
+    }
+
+    labels := make(map[string]bool, len(devices))
+
+    if *asJSON {
+        // Unsupported devices are listed too, with an empty type, so that nothing goes unnoticed.
+        descriptors := make([]config.MELCloudDeviceDescriptor, 0, len(devices))
+        for _, device := range devices {
+            var deviceType config.DeviceType
+            if factory, ok := driver.LookupMELCloudType(device.Type); ok {
+                deviceType = factory.Type
+            } else {
+                log.Warn().
+                    Int("DeviceID", device.DeviceID).
+                    Str("Name", device.DeviceName).
+                    Stringer("MELCloudType", device.Type).
+                    Msg("Device of unsupported type")
+            }
+
+            label := uniqueLabel(device.DeviceName, strconv.Itoa(device.DeviceID), labels)
+            labels[label] = true
+
+            descriptors = append(descriptors, config.MELCloudDeviceDescriptor{
+                Type: deviceType,
+                Label: label,
+                Id: strconv.Itoa(device.DeviceID),
+                BuildingId: strconv.Itoa(device.BuildingID),
+                Name: device.DeviceName,
+            })
+        }
+
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "    ")
+        if err := encoder.Encode(descriptors); err != nil {
+            log.Fatal().Err(err).Msg("Unable to encode devices")
+        }
+        return
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tBUILDING ID\tTYPE\tMELCLOUD TYPE\tLABEL\tNAME\tLOCATION")
+    for _, device := range devices {
+        deviceType := "(unsupported)"
+        if factory, ok := driver.LookupMELCloudType(device.Type); ok {
+            deviceType = string(factory.Type)
+        }
+
+        label := uniqueLabel(device.DeviceName, strconv.Itoa(device.DeviceID), labels)
+        labels[label] = true
+
+        location := device.BuildingName
+        for _, part := range []string{device.FloorName, device.AreaName} {
+            if part != "" {
+                location += " / " + part
+            }
+        }
+
+        fmt.Fprintf(
+            w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+            device.DeviceID, device.BuildingID, deviceType, device.Type, label, device.DeviceName, location,
+        )
+    }
+    w.Flush()
+}
@@ -1,30 +1,60 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"io"
-	"math"
+	"flag"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/robertof/go-melcloud"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"rbf.dev/melcloud_prometheus_exporter/config"
 	"rbf.dev/melcloud_prometheus_exporter/driver"
-	"rbf.dev/melcloud_prometheus_exporter/driver/ecodan"
+	"rbf.dev/melcloud_prometheus_exporter/melcloud"
+
+	// Drivers register themselves with the driver registry when imported.
+	_ "rbf.dev/melcloud_prometheus_exporter/driver/ata"
+	_ "rbf.dev/melcloud_prometheus_exporter/driver/ecodan"
+	_ "rbf.dev/melcloud_prometheus_exporter/driver/erv"
 )
 
 var (
     reg = prometheus.NewRegistry()
-    statsManagers = make(map[string]driver.StatsManager)
+    melcloudRegisterer = prometheus.WrapRegistererWithPrefix("melcloud_", reg)
+    statsManagersMu sync.RWMutex
+    statsManagers = make(map[string]*managedDevice)
+    timestampMode config.TimestampMode
 )
 
+// How long to wait for in-flight HTTP requests and statistics fetches when shutting down.
+const shutdownTimeout = 30 * time.Second
+
+func usage() {
+    out := flag.CommandLine.Output()
+    fmt.Fprintf(out, "Usage: %v <config-path>\n", os.Args[0])
+    fmt.Fprintf(out, "       %v list-devices [--json] <config-path>\n", os.Args[0])
+    fmt.Fprintf(out, "       %v validate-config <config-path>\n", os.Args[0])
+    fmt.Fprintf(out, "\nSupported device types:\n")
+    for _, factory := range driver.Factories() {
+        fmt.Fprintf(out, "  %-10v %v\n", factory.Type, factory.Description)
+    }
+}
+
 func main() {
+    flag.Usage = usage
+    flag.Parse()
+
     if os.Getenv("MELCLOUD_PROMETHEUS_EXPORTER_DEBUG") != "" {
         zerolog.SetGlobalLevel(zerolog.DebugLevel)
     } else if os.Getenv("MELCLOUD_PROMETHEUS_EXPORTER_TRACE") != "" {
@@ -35,180 +65,323 @@ func main() {
 
     log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-    if len(os.Args) < 2 {
-        log.Fatal().Msgf("Usage: %v <config-path>", os.Args[0])
+    if flag.NArg() < 1 {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    switch flag.Arg(0) {
+    case "list-devices":
+        listDevices(flag.Args()[1:])
+        return
+    case "validate-config":
+        validateConfig(flag.Args()[1:])
+        return
     }
 
-    configPath := os.Args[1]
+    configPath := flag.Arg(0)
 
     log.Debug().Str("path", configPath).Msg("Parsing configuration")
 
     // Parse the configuration.
-    cfg, err := config.Parse(configPath)
+    cfg, err := loadConfig(configPath)
     if err != nil {
-        log.Fatal().Err(err).Msg("Unable to parse config")
+        log.Fatal().Err(err).Msg("Unable to load config")
     }
 
-    requestor, err := melcloud.Authenticate(cfg.MELCloudConfig.Mail, cfg.MELCloudConfig.Password)
-    if err != nil {
-        log.Fatal().Err(err).Msg("Unable to authenticate with MELCloud")
+    timestampMode = cfg.Timestamps
+
+    if cfg.TimeZone != "" {
+        loc, err := time.LoadLocation(cfg.TimeZone)
+        if err != nil {
+            log.Fatal().Err(err).Str("TimeZone", cfg.TimeZone).Msg("Unknown time zone")
+        }
+
+        driver.SetTimeZone(loc)
     }
 
-    log.Info().Msg("Bootstrapping statistics managers...")
+    registerExporterMetrics(melcloudRegisterer)
 
-    melcloudRegisterer := prometheus.WrapRegistererWithPrefix("melcloud_", reg)
+    log.Info().Msg("Bootstrapping statistics managers...")
 
     for _, descriptor := range cfg.Devices {
-        if _, ok := statsManagers[descriptor.Label]; ok {
-            log.Panic().Str("Label", descriptor.Label).Msg("Duplicated device labels are not permitted!")
+        if err := setUpDevice(descriptor); err != nil {
+            log.Panic().Err(err).Str("Label", descriptor.Label).Msg("Unable to set up device")
+        }
+    }
+
+    // Stop polling and serving on SIGINT and SIGTERM, reload the configuration on SIGHUP.
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    reload := make(chan os.Signal, 1)
+    signal.Notify(reload, syscall.SIGHUP)
+
+    // Polls in flight when stopping are given some time to complete before being cancelled.
+    requests, cancelRequests := context.WithCancel(context.Background())
+    defer cancelRequests()
+
+    var scheduler *scheduler
+
+    if !cfg.ServeBeforeInitialFetch {
+        scheduler, err = bootstrap(ctx, requests, cfg, newRequestor(cfg.MELCloudConfig))
+        if err != nil {
+            if ctx.Err() != nil {
+                log.Info().Msg("Interrupted while connecting to MELCloud")
+                return
+            }
+            log.Fatal().Err(err).Msg("Unable to connect to MELCloud")
+        }
+
+        log.Info().Msg("Waiting for initial statistics fetch to succeed...")
+
+        if err := scheduler.initialFetch(ctx); err != nil {
+            if ctx.Err() != nil {
+                log.Info().Msg("Interrupted while waiting for initial statistics fetch")
+                return
+            }
+            log.Fatal().Err(err).Msg("Initial fetch failed")
         }
 
-        reg := prometheus.WrapRegistererWith(prometheus.Labels{
-            "device": descriptor.Label,
-        }, melcloudRegisterer)
-
-        switch descriptor.Type {
-        case config.DeviceTypeEcodan:
-            manager := ecodan.NewDefaultStatsManager()
-            statsManagers[descriptor.Label] = manager
-            manager.RegisterMetrics(reg)
-            break
-        default:
-            log.Panic().Str("DeviceType", string(descriptor.Type)).Msg("Unknown device type")
+        log.Info().Msg("Initial fetch completed successfully")
+    }
+
+    stopped := make(chan struct{})
+
+    go func() {
+        defer close(stopped)
+
+        if scheduler == nil {
+            // Keep retrying in the background, while exposing the exporter metrics meanwhile.
+            scheduler = bootstrapWithRetry(ctx, requests, cfg)
+            if scheduler == nil {
+                return
+            }
         }
+
+        runWithReload(ctx, requests, configPath, scheduler, reload)
+    }()
+
+    if err := serve(ctx, cfg); err != nil {
+        log.Fatal().Err(err).Msg("Prometheus server failed")
     }
 
-    initialFetchCh := make(chan bool)
+    log.Info().Msg("Waiting for in-flight statistics fetches to complete...")
 
-    go fetchStats(requestor, cfg.Devices, initialFetchCh)
+    select {
+    case <-stopped:
+    case <-time.After(shutdownTimeout):
+        log.Warn().Msg("Timed out waiting for statistics fetches to complete, cancelling them")
+        cancelRequests()
+        <-stopped
+    }
+}
 
-    log.Info().Msg("Waiting for initial statistics fetch to succeed...")
+// loadConfig parses and validates the configuration, including the web config it references.
+func loadConfig(path string) (*config.Config, error) {
+    cfg, err := config.Parse(path)
+    if err != nil {
+        return nil, err
+    }
 
-    if !<-initialFetchCh {
-        log.Fatal().Msg("Initial fetch failed")
+    var problems config.ValidationError
+    if err := cfg.Validate(driver.ValidateDescriptor); err != nil && !errors.As(err, &problems) {
+        return nil, err
     }
 
+    if cfg.WebConfigFile != "" {
+        if err := validateWebConfig(cfg.WebConfigFile); err != nil {
+            problems = append(problems, &config.FieldError{Path: "WebConfigFile", Err: err})
+        }
+    }
+
+    if len(problems) > 0 {
+        return nil, problems
+    }
+
+    return cfg, nil
+}
+
+func serve(ctx context.Context, cfg *config.Config) error {
     log.Info().
         Str("ListenAddress", cfg.ListenAddress).
-        Msg("Initial fetch completed successfully, starting Prometheus server")
+        Msg("Starting Prometheus server")
 
     http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-    http.ListenAndServe(cfg.ListenAddress, nil)
-}
+    http.HandleFunc("/healthz", healthz)
+    http.Handle("/readyz", readyz(time.Duration(cfg.ReadinessWindow)))
 
-func fetchStats(
-    requestor *melcloud.MelcloudRequestor,
-    devices []config.MELCloudDeviceDescriptor,
-    initialFetchCh chan bool,
-) {
-    didCompleteInitialFetch := false
-    backoffFactor := 1
-    nextCommunicationDates := make([]time.Time, 0, len(devices))
+    return listenAndServe(ctx, cfg)
+}
 
-    for {
-        var err error
-
-        for _, descriptor := range devices {
-            log.Debug().Str("Label", descriptor.Label).Msg("Fetching statistics for device")
-
-            var reader io.ReadCloser
-            reader, err = requestor.GetDeviceInformation(descriptor.Id, descriptor.BuildingId)
-
-            if err != nil {
-                log.Error().
-                    Err(err).
-                    Str("Label", descriptor.Label).
-                    Str("DeviceType", string(descriptor.Type)).
-                    Str("DeviceID", descriptor.Id).
-                    Str("BuildingID", descriptor.BuildingId).
-                    Msg("Failed to fetch statistics")
-                if reader != nil {
-                    reader.Close()
-                }
-                // if we are ratelimited, do not attempt to issue requests for other devices.
-                if !didCompleteInitialFetch || errors.Is(err, melcloud.ErrTooManyRequests) {
-                    break
-                }
-                continue
-            }
+// bootstrap authenticates with MELCloud, discovers devices if requested and returns a scheduler
+// ready to poll every device. Bootstrap requests are bound to `ctx`, while the scheduler's
+// polls are bound to `requests`.
+func bootstrap(ctx, requests context.Context, cfg *config.Config, requestor *melcloud.MelcloudRequestor) (*scheduler, error) {
+    if err := requestor.Login(ctx); err != nil {
+        return nil, fmt.Errorf("unable to authenticate: %w", err)
+    }
 
-            statsManager := statsManagers[descriptor.Label]
-            var update *driver.Update
-            update, err = statsManager.ParseAndUpdateStats(reader)
-            reader.Close()
-
-            if err != nil {
-                log.Error().
-                    Err(err).
-                    Str("Label", descriptor.Label).
-                    Str("DeviceType", string(descriptor.Type)).
-                    Str("DeviceID", descriptor.Id).
-                    Str("BuildingID", descriptor.BuildingId).
-                    Msg("Failed to decode model from statistics")
-                if !didCompleteInitialFetch {
-                    break
-                }
-                continue
-            }
+    devices := cfg.Devices
 
-            if update != nil {
-                nextCommunicationDates = append(nextCommunicationDates, update.NextCommunication)
-            }
+    if cfg.Discovery.Enabled {
+        discovered, err := discoverDevices(ctx, requestor, cfg.Discovery, devices)
+        if err != nil {
+            return nil, err
         }
 
-        if !didCompleteInitialFetch {
-            if err == nil {
-                didCompleteInitialFetch = true
-            }
+        devices = append(devices, setUpDiscoveredDevices(discovered)...)
+    }
 
-            initialFetchCh <- err == nil
+    registerRequestorMetrics(melcloudRegisterer, requestor)
 
-            if err != nil {
-                return
-            }
+    scheduler := newScheduler(requests, requestor, cfg, devices)
+    setActiveScheduler(scheduler)
+
+    return scheduler, nil
+}
+
+// bootstrapWithRetry retries bootstrap according to the backoff policy until it succeeds, or
+// returns nil once the context is done. The same requestor is kept across attempts, so that a
+// session established by an attempt failing later on is reused, and logins stay throttled.
+func bootstrapWithRetry(ctx, requests context.Context, cfg *config.Config) *scheduler {
+    random := rand.New(rand.NewSource(time.Now().UnixNano()))
+    factor := 1
+    requestor := newRequestor(cfg.MELCloudConfig)
+
+    for {
+        scheduler, err := bootstrap(ctx, requests, cfg, requestor)
+        if err == nil {
+            return scheduler
         }
 
-        // Determine the farthest communication date.
-        if len(nextCommunicationDates) == 0 {
-            // Try again based on the backoff factor if no attempt succeeded.
-            wait := time.Minute * time.Duration(math.Pow(2, float64(backoffFactor)))
-            if backoffFactor < 4 {
-                // limit to 16 mins (2**4) backoff.
-                backoffFactor += 1
-            }
-            log.Debug().Dur("Backoff", wait).Msg("No attempt succeeded - backing off")
-            <- time.After(wait)
-            continue
+        if ctx.Err() != nil {
+            return nil
         }
 
-        // reset backoff factor after any fetch succeeded.
-        backoffFactor = 1
-        var maxDate time.Time
+        var wait time.Duration
+        wait, factor = nextBackoff(cfg.Polling.Backoff, factor, random)
 
-        for _, date := range nextCommunicationDates {
-            if date.After(maxDate) {
-                maxDate = date
-            }
+        log.Error().Err(err).Dur("Backoff", wait).Msg("Unable to connect to MELCloud - retrying")
+
+        select {
+        case <-time.After(wait):
+        case <-ctx.Done():
+            return nil
         }
+    }
+}
 
-        nextCommunicationDates = make([]time.Time, 0, len(devices))
-
-        if maxDate.IsZero() || time.Until(maxDate) < 1 * time.Minute {
-            // enforce a minimum wait of 1m10s in case the date is in the past (likely due
-            // to some sort of time skew).
-            maxDate = time.Now().Add(1 * time.Minute + 10 * time.Second)
-            log.Debug().
-                Stringer("NextTick", maxDate).
-                Msg("Ignoring suggested next tick as it's zero or too small - using 1m10s")
-        } else if time.Until(maxDate) > 5 * time.Minute {
-            // do not bother waiting more than 5 minutes for an update.
-            maxDate = time.Now().Add(5 * time.Minute)
-            log.Debug().
-                Stringer("NextTick", maxDate).
-                Msg("Ignoring suggested next tick as it's over 5 minutes - using 5m")
+// managedDevice is the statistics manager of a device, along with the collectors it registered.
+type managedDevice struct {
+    descriptor config.MELCloudDeviceDescriptor
+    manager driver.StatsManager
+    registerer *trackingRegisterer
+}
+
+// trackingRegisterer remembers the collectors registered through it, so that they can be
+// unregistered when the device is removed.
+type trackingRegisterer struct {
+    prometheus.Registerer
+    collectors []prometheus.Collector
+}
+
+func (r *trackingRegisterer) Register(collector prometheus.Collector) error {
+    if err := r.Registerer.Register(collector); err != nil {
+        return err
+    }
+
+    r.collectors = append(r.collectors, collector)
+    return nil
+}
+
+func (r *trackingRegisterer) MustRegister(collectors ...prometheus.Collector) {
+    for _, collector := range collectors {
+        if err := r.Register(collector); err != nil {
+            panic(err)
         }
+    }
+}
+
+func (r *trackingRegisterer) unregisterAll() {
+    for _, collector := range r.collectors {
+        r.Registerer.Unregister(collector)
+    }
+    r.collectors = nil
+}
 
-        log.Debug().Time("NextTick", maxDate).Msg("Waiting until next tick to perform next statistics fetch")
+func lookupStatsManager(label string) driver.StatsManager {
+    statsManagersMu.RLock()
+    defer statsManagersMu.RUnlock()
 
-        <- time.After(time.Until(maxDate))
-    }}
+    if device, ok := statsManagers[label]; ok {
+        return device.manager
+    }
+    return nil
+}
+
+func setUpDevice(descriptor config.MELCloudDeviceDescriptor) error {
+    statsManagersMu.Lock()
+    defer statsManagersMu.Unlock()
+
+    if _, ok := statsManagers[descriptor.Label]; ok {
+        return fmt.Errorf("duplicated device label '%v'", descriptor.Label)
+    }
+
+    manager, err := driver.NewStatsManager(descriptor)
+    if err != nil {
+        return err
+    }
+
+    registerDevice(&managedDevice{descriptor: descriptor, manager: manager})
+    return nil
+}
+
+// registerDevice registers the metrics of a device. Must be called with the lock held.
+func registerDevice(device *managedDevice) {
+    device.registerer = &trackingRegisterer{
+        Registerer: prometheus.WrapRegistererWith(prometheus.Labels{
+            "device": device.descriptor.Label,
+        }, melcloudRegisterer),
+    }
+
+    statsManagers[device.descriptor.Label] = device
+    device.manager.RegisterMetrics(device.registerer, driver.CollectorOptions{
+        MaxAge: time.Duration(device.descriptor.MaxAge),
+        Timestamps: timestampMode,
+    })
+}
+
+// tearDownDevice unregisters every metric of a device. Must be called with the lock held.
+func tearDownDevice(label string) {
+    device, ok := statsManagers[label]
+    if !ok {
+        return
+    }
+
+    device.registerer.unregisterAll()
+    delete(statsManagers, label)
+
+    fetchAttempts.DeleteLabelValues(label)
+    fetchFailures.DeletePartialMatch(prometheus.Labels{"device": label})
+    fetchDuration.DeleteLabelValues(label)
+    energyReportFailures.DeletePartialMatch(prometheus.Labels{"device": label})
+    lastSuccessfulFetch.DeleteLabelValues(label)
+    backoffFactorGauge.DeleteLabelValues(label)
+}
+
+// setUpDiscoveredDevices sets up the given devices, skipping the ones which fail to do so, and
+// returns the ones which succeeded.
+func setUpDiscoveredDevices(discovered []config.MELCloudDeviceDescriptor) []config.MELCloudDeviceDescriptor {
+    out := make([]config.MELCloudDeviceDescriptor, 0, len(discovered))
+
+    for _, descriptor := range discovered {
+        if err := setUpDevice(descriptor); err != nil {
+            log.Error().Err(err).Str("Label", descriptor.Label).Msg("Unable to set up discovered device")
+            continue
+        }
+        out = append(out, descriptor)
+    }
+
+    return out
+}
@@ -0,0 +1,105 @@
+package melcloud
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+)
+
+// Device type, as reported by MELCloud.
+type DeviceType int
+
+const (
+    DeviceTypeATA DeviceType = 0
+    DeviceTypeATW DeviceType = 1
+    DeviceTypeERV DeviceType = 3
+)
+
+type Device struct {
+    DeviceID int
+    DeviceName string
+    BuildingID int
+    Type DeviceType
+
+    // Names of the building, floor and area containing the device. Floor and area are empty
+    // when the device is not assigned to one.
+    BuildingName, FloorName, AreaName string `json:"-"`
+}
+
+type area struct {
+    Name string
+    Devices []Device
+}
+
+type floor struct {
+    Name string
+    Devices []Device
+    Areas []area
+}
+
+type building struct {
+    ID int
+    Name string
+    Structure struct {
+        Floors []floor
+        Areas []area
+        Devices []Device
+    }
+}
+
+// ListDevices returns every device visible to the authenticated account, across all buildings,
+// floors and areas.
+func (r *MelcloudRequestor) ListDevices(ctx context.Context) ([]Device, error) {
+    body, err := r.do(ctx, http.MethodGet, "/User/ListDevices", nil)
+    if err != nil {
+        return nil, err
+    }
+
+    defer body.Close()
+
+    var buildings []building
+    if err := json.NewDecoder(body).Decode(&buildings); err != nil {
+        return nil, fmt.Errorf("unable to decode device list: %w", err)
+    }
+
+    var devices []Device
+    add := func(floorName, areaName string, list []Device, b *building) {
+        for _, device := range list {
+            device.BuildingName, device.FloorName, device.AreaName = b.Name, floorName, areaName
+            if device.BuildingID == 0 {
+                device.BuildingID = b.ID
+            }
+            devices = append(devices, device)
+        }
+    }
+
+    for i := range buildings {
+        b := &buildings[i]
+        add("", "", b.Structure.Devices, b)
+        for _, a := range b.Structure.Areas {
+            add("", a.Name, a.Devices, b)
+        }
+        for _, f := range b.Structure.Floors {
+            add(f.Name, "", f.Devices, b)
+            for _, a := range f.Areas {
+                add(f.Name, a.Name, a.Devices, b)
+            }
+        }
+    }
+
+    return devices, nil
+}
+
+func (t DeviceType) String() string {
+    switch t {
+    case DeviceTypeATA:
+        return "ATA"
+    case DeviceTypeATW:
+        return "ATW"
+    case DeviceTypeERV:
+        return "ERV"
+    default:
+        return fmt.Sprintf("Unknown(%d)", int(t))
+    }
+}
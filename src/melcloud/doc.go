@@ -0,0 +1,9 @@
+// Package melcloud is a client for the MELCloud API used by the Mitsubishi Electric apps.
+//
+// It replaces github.com/robertof/go-melcloud, which the exporter used to depend on. That
+// module only exposes logging in and fetching the state of a device, while the exporter also
+// needs the energy report and device list endpoints, to resume a cached session, to learn about
+// Retry-After hints and to cancel requests when shutting down, all of which require control over
+// the HTTP requests themselves. Keeping the client in-tree lets those evolve together with the
+// exporter.
+package melcloud
@@ -0,0 +1,31 @@
+package melcloud
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+type energyReportRequest struct {
+    DeviceId int
+    FromDate, ToDate string
+    UseCurrency bool
+}
+
+// GetEnergyReport returns the raw JSON energy report for a device, covering the days between
+// `from` and `to` (both inclusive). Only the date portion of the arguments is considered.
+// The caller is responsible for closing the returned reader.
+func (r *MelcloudRequestor) GetEnergyReport(ctx context.Context, deviceId string, from, to time.Time) (io.ReadCloser, error) {
+    id, err := strconv.Atoi(deviceId)
+    if err != nil {
+        return nil, err
+    }
+
+    return r.do(ctx, http.MethodPost, "/EnergyCost/Report", energyReportRequest{
+        DeviceId: id,
+        FromDate: from.Format("2006-01-02") + "T00:00:00",
+        ToDate: to.Format("2006-01-02") + "T00:00:00",
+    })
+}
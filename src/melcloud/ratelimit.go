@@ -0,0 +1,144 @@
+package melcloud
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// RateLimitError is returned when MELCloud rejects a request as rate limited. It matches
+// ErrTooManyRequests with errors.Is.
+type RateLimitError struct {
+    // How long MELCloud asked to wait before retrying, zero if no hint was given.
+    RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+    if e.RetryAfter > 0 {
+        return fmt.Sprintf("%v (retry after %v)", ErrTooManyRequests, e.RetryAfter)
+    }
+    return ErrTooManyRequests.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+    return target == ErrTooManyRequests
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+    value := header.Get("Retry-After")
+    if value == "" {
+        return 0
+    }
+
+    if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+
+    if date, err := http.ParseTime(value); err == nil && time.Until(date) > 0 {
+        return time.Until(date)
+    }
+
+    return 0
+}
+
+// RateLimiter is a token bucket shared by every request issued by a requestor, which also
+// holds off all requests when MELCloud asks to retry later.
+type RateLimiter struct {
+    mu sync.Mutex
+    capacity float64
+    tokens float64
+    // Tokens added per second.
+    rate float64
+    last time.Time
+    blockedUntil time.Time
+}
+
+// NewRateLimiter returns a limiter allowing `requestsPerHour` requests on average, in bursts of
+// at most `burst` requests.
+func NewRateLimiter(requestsPerHour, burst int) *RateLimiter {
+    if burst < 1 {
+        burst = 1
+    }
+
+    return &RateLimiter{
+        capacity: float64(burst),
+        tokens: float64(burst),
+        rate: float64(requestsPerHour) / time.Hour.Seconds(),
+        last: time.Now(),
+    }
+}
+
+// refill must be called with the lock held.
+func (l *RateLimiter) refill(now time.Time) {
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > l.capacity {
+        l.tokens = l.capacity
+    }
+    l.last = now
+}
+
+// reserve takes a token if one is available, otherwise returns how long to wait for one.
+func (l *RateLimiter) reserve() time.Duration {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    l.refill(now)
+
+    if now.Before(l.blockedUntil) {
+        return l.blockedUntil.Sub(now)
+    }
+
+    if l.tokens >= 1 {
+        l.tokens -= 1
+        return 0
+    }
+
+    return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Wait blocks until a request can be issued, or fails once the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+    for {
+        wait := l.reserve()
+        if wait <= 0 {
+            return nil
+        }
+
+        timer := time.NewTimer(wait)
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        }
+    }
+}
+
+// Defer holds off every request for the given duration.
+func (l *RateLimiter) Defer(d time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if until := time.Now().Add(d); until.After(l.blockedUntil) {
+        l.blockedUntil = until
+    }
+}
+
+// Remaining returns the number of requests which can currently be issued without waiting.
+func (l *RateLimiter) Remaining() float64 {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    l.refill(now)
+
+    if now.Before(l.blockedUntil) {
+        return 0
+    }
+
+    return l.tokens
+}
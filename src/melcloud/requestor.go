@@ -0,0 +1,350 @@
+package melcloud
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sync"
+    "time"
+)
+
+const (
+    requestTimeout = 30 * time.Second
+    minReauthBackoff = 1 * time.Minute
+    maxReauthBackoff = 16 * time.Minute
+)
+
+var (
+    ErrTooManyRequests = errors.New("melcloud: too many requests")
+    ErrUnauthorized = errors.New("melcloud: unauthorized")
+)
+
+// StatusError is returned when MELCloud answers with an unexpected HTTP status code.
+type StatusError struct {
+    StatusCode int
+    Path string
+}
+
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("melcloud: unexpected status code %v for %v", e.StatusCode, e.Path)
+}
+
+// Endpoint identifies the MELCloud API to talk to.
+type Endpoint struct {
+    // URL the API paths are relative to, e.g. "https://app.melcloud.com/Mitsubishi.Wifi.Client".
+    BaseURL string
+    // Version of the MELCloud app reported when logging in.
+    AppVersion string
+}
+
+type MelcloudRequestor struct {
+    client *http.Client
+    endpoint Endpoint
+    mail, password string
+
+    // Serialises logins, which must not hold mu as they go through send.
+    loginMu sync.Mutex
+
+    mu sync.Mutex
+    limiter *RateLimiter
+    session Session
+    loginHook func(Session)
+    reauthentications uint64
+    reauthBackoff time.Duration
+    nextReauth time.Time
+}
+
+type loginRequest struct {
+    Email, Password, AppVersion string
+    Language int
+    Persist bool
+    CaptchaResponse *string
+}
+
+type loginResponse struct {
+    ErrorId *int
+    ErrorMessage *string
+    LoginData *struct {
+        ContextKey string
+        Expiry string
+    }
+}
+
+// Session identifies an authenticated MELCloud session.
+type Session struct {
+    ContextKey string
+    // Expiry as reported by MELCloud. Zero if unknown.
+    Expiry time.Time
+}
+
+func parseExpiry(value string) time.Time {
+    // MELCloud reports the expiry without a time zone, with optional fractional seconds.
+    expiry, err := time.Parse("2006-01-02T15:04:05.999999999", value)
+    if err != nil {
+        return time.Time{}
+    }
+    return expiry
+}
+
+// Authenticate logs into MELCloud with the given credentials and returns a requestor bound to
+// the resulting session. The credentials are retained to transparently log in again whenever
+// the session expires.
+func Authenticate(ctx context.Context, endpoint Endpoint, mail, password string) (*MelcloudRequestor, error) {
+    r := Resume(endpoint, mail, password, Session{})
+
+    if err := r.Login(ctx); err != nil {
+        return nil, err
+    }
+
+    return r, nil
+}
+
+// Resume returns a requestor bound to a previously established session, without logging in.
+// The credentials are only used if MELCloud rejects the session, or if the session is empty
+// and Login is called.
+func Resume(endpoint Endpoint, mail, password string, session Session) *MelcloudRequestor {
+    return &MelcloudRequestor{
+        client: &http.Client{Timeout: requestTimeout},
+        endpoint: endpoint,
+        mail: mail,
+        password: password,
+        session: session,
+    }
+}
+
+func (r *MelcloudRequestor) login(ctx context.Context) (Session, error) {
+    body, err := r.send(ctx, http.MethodPost, "/Login/ClientLogin", "", loginRequest{
+        Email: r.mail,
+        Password: r.password,
+        AppVersion: r.endpoint.AppVersion,
+        Persist: true,
+    })
+    if err != nil {
+        return Session{}, fmt.Errorf("login failed: %w", err)
+    }
+
+    defer body.Close()
+
+    var response loginResponse
+    if err := json.NewDecoder(body).Decode(&response); err != nil {
+        return Session{}, fmt.Errorf("unable to decode login response: %w", err)
+    }
+
+    if response.ErrorId != nil || response.LoginData == nil || response.LoginData.ContextKey == "" {
+        message := "unknown error"
+        if response.ErrorMessage != nil {
+            message = *response.ErrorMessage
+        }
+        return Session{}, fmt.Errorf("%w: login rejected: %v", ErrUnauthorized, message)
+    }
+
+    return Session{
+        ContextKey: response.LoginData.ContextKey,
+        Expiry: parseExpiry(response.LoginData.Expiry),
+    }, nil
+}
+
+// Session returns the session currently in use.
+func (r *MelcloudRequestor) Session() Session {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return r.session
+}
+
+// SetRateLimiter makes every subsequent request go through the given limiter.
+func (r *MelcloudRequestor) SetRateLimiter(limiter *RateLimiter) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.limiter = limiter
+}
+
+// RateLimiter returns the limiter in use, if any.
+func (r *MelcloudRequestor) RateLimiter() *RateLimiter {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return r.limiter
+}
+
+// SetLoginHook registers a function invoked with the new session whenever the requestor logs
+// in again, e.g. to persist it.
+func (r *MelcloudRequestor) SetLoginHook(hook func(Session)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.loginHook = hook
+}
+
+// Login logs in unless the requestor already holds a session. Failed attempts are throttled
+// like session renewals, so that callers retrying in a loop don't lock the account.
+func (r *MelcloudRequestor) Login(ctx context.Context) error {
+    _, err := r.reauthenticate(ctx, "")
+    return err
+}
+
+// reauthenticate replaces the session identified by `staleKey` with a new one, or establishes
+// the first one if `staleKey` is empty. Concurrent
+// callers observing the same stale session only trigger a single login, and failed logins are
+// retried with an exponential backoff to avoid locking the account.
+func (r *MelcloudRequestor) reauthenticate(ctx context.Context, staleKey string) (string, error) {
+    r.loginMu.Lock()
+    defer r.loginMu.Unlock()
+
+    r.mu.Lock()
+    current, nextReauth := r.session.ContextKey, r.nextReauth
+    r.mu.Unlock()
+
+    if current != staleKey {
+        // Somebody else already logged in again.
+        return current, nil
+    }
+
+    if time.Now().Before(nextReauth) {
+        return "", fmt.Errorf("%w: login failed, next attempt at %v", ErrUnauthorized, nextReauth)
+    }
+
+    session, err := r.login(ctx)
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if err != nil {
+        if ctx.Err() != nil {
+            // Not MELCloud's fault, don't hold off the next attempt.
+            return "", err
+        }
+        if r.reauthBackoff == 0 {
+            r.reauthBackoff = minReauthBackoff
+        } else if r.reauthBackoff < maxReauthBackoff {
+            r.reauthBackoff *= 2
+        }
+        r.nextReauth = time.Now().Add(r.reauthBackoff)
+        if staleKey == "" {
+            return "", err
+        }
+        return "", fmt.Errorf("session expired and unable to log in again: %w", err)
+    }
+
+    if staleKey != "" {
+        r.reauthentications += 1
+    }
+    r.session = session
+    r.reauthBackoff = 0
+    r.nextReauth = time.Time{}
+
+    if r.loginHook != nil {
+        r.loginHook(session)
+    }
+
+    return session.ContextKey, nil
+}
+
+// Authenticated returns whether the requestor holds a session which wasn't rejected, or was
+// renewed successfully.
+func (r *MelcloudRequestor) Authenticated() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return r.session.ContextKey != "" && r.nextReauth.IsZero()
+}
+
+// Reauthentications returns how many times the session was renewed after expiring.
+func (r *MelcloudRequestor) Reauthentications() uint64 {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return r.reauthentications
+}
+
+// GetDeviceInformation returns the raw JSON payload describing the current state of a device.
+// The caller is responsible for closing the returned reader.
+func (r *MelcloudRequestor) GetDeviceInformation(ctx context.Context, deviceId, buildingId string) (io.ReadCloser, error) {
+    query := url.Values{}
+    query.Set("id", deviceId)
+    query.Set("buildingID", buildingId)
+
+    return r.do(ctx, http.MethodGet, "/Device/Get?" + query.Encode(), nil)
+}
+
+// do performs an authenticated request, logging in again once if the session was rejected.
+func (r *MelcloudRequestor) do(ctx context.Context, method, path string, payload interface{}) (io.ReadCloser, error) {
+    contextKey := r.Session().ContextKey
+
+    body, err := r.send(ctx, method, path, contextKey, payload)
+    if !errors.Is(err, ErrUnauthorized) {
+        return body, err
+    }
+
+    contextKey, err = r.reauthenticate(ctx, contextKey)
+    if err != nil {
+        return nil, err
+    }
+
+    return r.send(ctx, method, path, contextKey, payload)
+}
+
+// send issues a single request. Cancelling the context aborts it, including while waiting for
+// the rate limiter.
+func (r *MelcloudRequestor) send(ctx context.Context, method, path, contextKey string, payload interface{}) (io.ReadCloser, error) {
+    var body io.Reader
+    if payload != nil {
+        encoded, err := json.Marshal(payload)
+        if err != nil {
+            return nil, err
+        }
+        body = bytes.NewReader(encoded)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, r.endpoint.BaseURL + path, body)
+    if err != nil {
+        return nil, err
+    }
+
+    req.Header.Set("Accept", "application/json")
+    if payload != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if contextKey != "" {
+        req.Header.Set("X-MitsContextKey", contextKey)
+    }
+
+    r.mu.Lock()
+    limiter := r.limiter
+    r.mu.Unlock()
+
+    if limiter != nil {
+        if err := limiter.Wait(ctx); err != nil {
+            return nil, err
+        }
+    }
+
+    res, err := r.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+
+    switch {
+    case res.StatusCode == http.StatusTooManyRequests:
+        res.Body.Close()
+        retryAfter := parseRetryAfter(res.Header)
+        if limiter != nil && retryAfter > 0 {
+            limiter.Defer(retryAfter)
+        }
+        return nil, &RateLimitError{retryAfter}
+    case res.StatusCode == http.StatusUnauthorized:
+        res.Body.Close()
+        return nil, ErrUnauthorized
+    case res.StatusCode < 200 || res.StatusCode > 299:
+        res.Body.Close()
+        return nil, &StatusError{StatusCode: res.StatusCode, Path: path}
+    }
+
+    return res.Body, nil
+}
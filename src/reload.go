@@ -0,0 +1,260 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "reflect"
+    "time"
+
+    "github.com/rs/zerolog/log"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+)
+
+// pendingReload is a validated configuration, ready to replace the running one.
+type pendingReload struct {
+    cfg *config.Config
+    // Every device to poll, including the previously discovered ones which are kept.
+    devices []config.MELCloudDeviceDescriptor
+    location *time.Location
+    // Devices which are new or whose descriptor changed, keyed by label.
+    added map[string]*managedDevice
+}
+
+// reusableKey identifies the statistics managers which can be carried over by a reload.
+type reusableKey struct {
+    deviceType config.DeviceType
+    id string
+}
+
+// prepareReload parses the configuration and sets up the statistics managers of the devices
+// which changed, without touching the running ones, so that an invalid configuration can be
+// rejected as a whole.
+func prepareReload(
+    path string,
+    current *config.Config,
+    running []config.MELCloudDeviceDescriptor,
+) (*pendingReload, error) {
+    cfg, err := loadConfig(path)
+    if err != nil {
+        return nil, err
+    }
+
+    if cfg.ListenAddress != current.ListenAddress ||
+        cfg.WebConfigFile != current.WebConfigFile ||
+        cfg.ReadinessWindow != current.ReadinessWindow ||
+        cfg.ServeBeforeInitialFetch != current.ServeBeforeInitialFetch ||
+        !reflect.DeepEqual(cfg.MELCloudConfig, current.MELCloudConfig) {
+        log.Warn().Msg("Changes to the listener and MELCloud settings require a restart and are ignored")
+        cfg.ListenAddress = current.ListenAddress
+        cfg.WebConfigFile = current.WebConfigFile
+        cfg.ReadinessWindow = current.ReadinessWindow
+        cfg.ServeBeforeInitialFetch = current.ServeBeforeInitialFetch
+        cfg.MELCloudConfig = current.MELCloudConfig
+    }
+
+    location := time.Local
+    if cfg.TimeZone != "" {
+        location, err = time.LoadLocation(cfg.TimeZone)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    reload := &pendingReload{
+        cfg: cfg,
+        location: location,
+        added: make(map[string]*managedDevice),
+    }
+
+    ids := make(map[string]bool, len(cfg.Devices))
+    labels := make(map[string]bool, len(cfg.Devices))
+    for _, descriptor := range cfg.Devices {
+        ids[descriptor.Id] = true
+        labels[descriptor.Label] = true
+    }
+
+    reload.devices = append(reload.devices, cfg.Devices...)
+
+    // Keep the discovered devices which are still allowed as long as discovery stays enabled,
+    // unless they're now configured explicitly. Their labels and overrides follow the new
+    // discovery settings.
+    if cfg.Discovery.Enabled {
+        configured := make(map[string]bool, len(current.Devices))
+        for _, descriptor := range current.Devices {
+            configured[descriptor.Label] = true
+        }
+
+        for _, label := range cfg.Discovery.Labels {
+            labels[label] = true
+        }
+
+        for _, descriptor := range running {
+            if configured[descriptor.Label] || ids[descriptor.Id] ||
+                !discoveryAllows(cfg.Discovery, descriptor.Id, descriptor.Name) {
+                continue
+            }
+
+            descriptor = applyDiscoverySettings(cfg.Discovery, descriptor, labels)
+            ids[descriptor.Id] = true
+            labels[descriptor.Label] = true
+            reload.devices = append(reload.devices, descriptor)
+        }
+    }
+
+    statsManagersMu.RLock()
+    defer statsManagersMu.RUnlock()
+
+    // Statistics managers are carried over to devices which are still the same device handled
+    // by the same driver, so that accumulated state such as energy totals survives a change
+    // of label or settings.
+    reusable := make(map[reusableKey]driver.StatsManager, len(statsManagers))
+    for _, existing := range statsManagers {
+        reusable[reusableKey{existing.descriptor.Type, existing.descriptor.Id}] = existing.manager
+    }
+
+    var changed []config.MELCloudDeviceDescriptor
+    for _, descriptor := range reload.devices {
+        if existing, ok := statsManagers[descriptor.Label]; ok &&
+            existing.descriptor == descriptor && cfg.Timestamps == timestampMode {
+            delete(reusable, reusableKey{descriptor.Type, descriptor.Id})
+            continue
+        }
+
+        changed = append(changed, descriptor)
+    }
+
+    for _, descriptor := range changed {
+        key := reusableKey{descriptor.Type, descriptor.Id}
+        manager, ok := reusable[key]
+        if ok {
+            delete(reusable, key)
+        } else {
+            manager, err = driver.NewStatsManager(descriptor)
+            if err != nil {
+                return nil, fmt.Errorf("device '%v': %w", descriptor.Label, err)
+            }
+        }
+
+        reload.added[descriptor.Label] = &managedDevice{descriptor: descriptor, manager: manager}
+    }
+
+    return reload, nil
+}
+
+// apply unregisters the metrics of the devices which were removed or changed and registers the
+// new ones. No poll may be in flight.
+func (r *pendingReload) apply() (removed int) {
+    statsManagersMu.Lock()
+    defer statsManagersMu.Unlock()
+
+    keep := make(map[string]bool, len(r.devices))
+    for _, descriptor := range r.devices {
+        keep[descriptor.Label] = r.added[descriptor.Label] == nil
+    }
+
+    for label := range statsManagers {
+        if !keep[label] {
+            tearDownDevice(label)
+            removed++
+        }
+    }
+
+    timestampMode = r.cfg.Timestamps
+    driver.SetTimeZone(r.location)
+
+    for _, device := range r.added {
+        registerDevice(device)
+    }
+
+    return removed
+}
+
+// configModTime returns when the configuration file was last modified, or the zero time if it
+// can't be determined, e.g. while it's being replaced.
+func configModTime(path string) time.Time {
+    info, err := os.Stat(path)
+    if err != nil {
+        return time.Time{}
+    }
+
+    return info.ModTime()
+}
+
+// runWithReload runs the scheduler until the context is done. Whenever a signal is received on
+// `reload`, or the configuration file changes if ReloadCheckInterval is set, the configuration
+// is parsed again and, if valid, the scheduler is replaced with one polling the updated devices
+// with requests bound to `requests`, reusing the MELCloud session.
+func runWithReload(
+    ctx, requests context.Context,
+    configPath string,
+    s *scheduler,
+    reload <-chan os.Signal,
+) {
+    lastModified := configModTime(configPath)
+
+    for {
+        runCtx, cancel := context.WithCancel(ctx)
+        done := make(chan struct{})
+
+        go func(s *scheduler) {
+            defer close(done)
+            s.run(runCtx)
+        }(s)
+
+        var check <-chan time.Time
+        stopCheck := func() {}
+        if interval := time.Duration(s.cfg.ReloadCheckInterval); interval > 0 {
+            ticker := time.NewTicker(interval)
+            check, stopCheck = ticker.C, ticker.Stop
+        }
+
+        var pending *pendingReload
+        for pending == nil {
+            select {
+            case <-ctx.Done():
+                stopCheck()
+                cancel()
+                <-done
+                return
+            case <-reload:
+            case <-check:
+                modified := configModTime(configPath)
+                if modified.IsZero() || modified.Equal(lastModified) {
+                    continue
+                }
+                lastModified = modified
+            }
+
+            log.Info().Str("path", configPath).Msg("Reloading configuration")
+
+            var err error
+            pending, err = prepareReload(configPath, s.cfg, s.descriptors())
+            if err != nil {
+                log.Error().Err(err).Msg("Invalid configuration, keeping the current one")
+            }
+        }
+
+        // Abort the polls in flight rather than waiting for them, the next scheduler retries them
+        // right away.
+        stopCheck()
+        cancel()
+        s.abort()
+        <-done
+
+        removed := pending.apply()
+
+        next := newScheduler(requests, s.requestor, pending.cfg, pending.devices)
+        next.inherit(s)
+        setActiveScheduler(next)
+        s = next
+
+        log.Info().
+            Int("Devices", len(pending.devices)).
+            Int("Added", len(pending.added)).
+            Int("Removed", removed).
+            Msg("Configuration reloaded")
+    }
+}
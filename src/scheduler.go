@@ -0,0 +1,523 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "math/rand"
+    "sync"
+    "time"
+
+    "github.com/rs/zerolog/log"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/driver"
+    "rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+// Polling state of an individual device.
+type deviceSchedule struct {
+    descriptor config.MELCloudDeviceDescriptor
+    nextPoll time.Time
+    backoffFactor int
+    lastEnergyReport time.Time
+    // Whether a poll is currently in flight.
+    polling bool
+    // Whether the last poll succeeded.
+    healthy bool
+    lastSuccess time.Time
+}
+
+// scheduler polls each device according to its own schedule, derived from the next
+// communication time MELCloud suggests for it, while sharing a concurrency and rate budget
+// across all devices.
+type scheduler struct {
+    requestor *melcloud.MelcloudRequestor
+    cfg *config.Config
+    // Context of the MELCloud requests issued by the polls started by `run`. Cancelling it aborts
+    // the polls in flight, as does `abort`, which only affects this scheduler.
+    requests context.Context
+    abort context.CancelFunc
+
+    mu sync.Mutex
+    devices []*deviceSchedule
+
+    // Signalled whenever a poll completes, so that the schedule is re-evaluated.
+    wake chan struct{}
+    // Bounds the number of polls in flight.
+    slots chan struct{}
+    // Tracks the polls in flight, so that they can be drained when stopping.
+    inflight sync.WaitGroup
+    // Only used with the lock held.
+    rand *rand.Rand
+    lastStart time.Time
+    // When to discover devices next, and the backoff factor applied if that fails.
+    nextDiscovery time.Time
+    discoveryFactor int
+}
+
+func newScheduler(
+    requests context.Context,
+    requestor *melcloud.MelcloudRequestor,
+    cfg *config.Config,
+    devices []config.MELCloudDeviceDescriptor,
+) *scheduler {
+    requests, abort := context.WithCancel(requests)
+
+    s := &scheduler{
+        requestor: requestor,
+        cfg: cfg,
+        requests: requests,
+        abort: abort,
+        wake: make(chan struct{}, 1),
+        slots: make(chan struct{}, cfg.Polling.MaxConcurrency),
+        rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+        nextDiscovery: time.Now().Add(time.Duration(cfg.Discovery.Interval)),
+        discoveryFactor: 1,
+    }
+
+    s.addDevices(devices)
+
+    return s
+}
+
+func (s *scheduler) addDevices(devices []config.MELCloudDeviceDescriptor) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, descriptor := range devices {
+        s.devices = append(s.devices, &deviceSchedule{
+            descriptor: descriptor,
+            nextPoll: time.Now(),
+            backoffFactor: 1,
+        })
+    }
+}
+
+// inherit carries the polling state of the devices which are still scheduled over from the
+// previous scheduler, so that a reload doesn't trigger a burst of requests. The previous
+// scheduler must not be running anymore.
+func (s *scheduler) inherit(previous *scheduler) {
+    previous.mu.Lock()
+    defer previous.mu.Unlock()
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    schedules := make(map[string]*deviceSchedule, len(previous.devices))
+    for _, device := range previous.devices {
+        schedules[device.descriptor.Label] = device
+    }
+
+    for _, device := range s.devices {
+        if schedule, ok := schedules[device.descriptor.Label]; ok && schedule.descriptor == device.descriptor {
+            *device = *schedule
+        }
+    }
+
+    s.lastStart = previous.lastStart
+
+    // Discover right away if discovery was just enabled.
+    if previous.cfg.Discovery.Enabled {
+        s.nextDiscovery = previous.nextDiscovery
+        s.discoveryFactor = previous.discoveryFactor
+    } else {
+        s.nextDiscovery = time.Time{}
+    }
+}
+
+func (s *scheduler) descriptors() []config.MELCloudDeviceDescriptor {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    out := make([]config.MELCloudDeviceDescriptor, len(s.devices))
+    for i, device := range s.devices {
+        out[i] = device.descriptor
+    }
+
+    return out
+}
+
+// status returns the polling status of every device, keyed by label.
+func (s *scheduler) status() map[string]deviceStatus {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    out := make(map[string]deviceStatus, len(s.devices))
+    for _, device := range s.devices {
+        status := deviceStatus{Healthy: device.healthy, NextPoll: device.nextPoll}
+        if !device.lastSuccess.IsZero() {
+            lastSuccess := device.lastSuccess
+            status.LastSuccessfulFetch = &lastSuccess
+        }
+        out[device.descriptor.Label] = status
+    }
+
+    return out
+}
+
+// initialFetch polls every device once, sequentially, and fails on the first error or when the
+// context is done.
+func (s *scheduler) initialFetch(ctx context.Context) error {
+    s.mu.Lock()
+    devices := append([]*deviceSchedule(nil), s.devices...)
+    s.mu.Unlock()
+
+    for _, device := range devices {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+
+        if err := s.poll(ctx, device); err != nil {
+            return fmt.Errorf("device '%v': %w", device.descriptor.Label, err)
+        }
+    }
+
+    return nil
+}
+
+// nextDevice returns the idle device which is due the soonest, if any. Must be called with the
+// lock held.
+func (s *scheduler) nextDevice() *deviceSchedule {
+    var next *deviceSchedule
+
+    for _, device := range s.devices {
+        if !device.polling && (next == nil || device.nextPoll.Before(next.nextPoll)) {
+            next = device
+        }
+    }
+
+    return next
+}
+
+func (s *scheduler) notify() {
+    select {
+    case s.wake <- struct{}{}:
+    default:
+    }
+}
+
+// run polls the devices until the context is done, then waits for the polls in flight to
+// complete.
+func (s *scheduler) run(ctx context.Context) {
+    defer s.inflight.Wait()
+
+    for {
+        var discoveryTimer, pollTimer *time.Timer
+        var discoveryCh, pollCh <-chan time.Time
+
+        if s.cfg.Discovery.Enabled {
+            if !time.Now().Before(s.nextDiscovery) {
+                s.discover(s.requests)
+            }
+            discoveryTimer = time.NewTimer(time.Until(s.nextDiscovery))
+            discoveryCh = discoveryTimer.C
+        }
+
+        s.mu.Lock()
+        next := s.nextDevice()
+        s.mu.Unlock()
+
+        if next != nil {
+            log.Debug().
+                Str("Label", next.descriptor.Label).
+                Time("NextTick", next.nextPoll).
+                Msg("Waiting until next tick to perform next statistics fetch")
+            setNextPoll(next.nextPoll)
+            pollTimer = time.NewTimer(time.Until(next.nextPoll))
+            pollCh = pollTimer.C
+        }
+
+        due := false
+        select {
+        case <-pollCh:
+            due = true
+        case <-s.wake:
+        case <-discoveryCh:
+        case <-ctx.Done():
+        }
+
+        for _, timer := range []*time.Timer{discoveryTimer, pollTimer} {
+            if timer != nil {
+                timer.Stop()
+            }
+        }
+
+        if ctx.Err() != nil {
+            return
+        }
+
+        if !due {
+            continue
+        }
+
+        select {
+        case s.slots <- struct{}{}:
+        case <-ctx.Done():
+            return
+        }
+
+        // Spread requests out according to the global rate budget.
+        if wait := time.Until(s.lastStart.Add(time.Duration(s.cfg.Polling.MinSpacing))); wait > 0 {
+            select {
+            case <-time.After(wait):
+            case <-ctx.Done():
+                <-s.slots
+                return
+            }
+        }
+        s.lastStart = time.Now()
+
+        s.mu.Lock()
+        next.polling = true
+        s.mu.Unlock()
+
+        s.inflight.Add(1)
+        go func(device *deviceSchedule) {
+            defer s.inflight.Done()
+            defer s.notify()
+            defer func() { <-s.slots }()
+            s.poll(s.requests, device)
+        }(next)
+    }
+}
+
+func (s *scheduler) discover(ctx context.Context) {
+    // Failures are not fatal here, the devices found so far keep being polled.
+    discovered, err := discoverDevices(ctx, s.requestor, s.cfg.Discovery, s.descriptors())
+    if err != nil {
+        // Retry with the same backoff as failed polls, rather than hammering the account.
+        s.mu.Lock()
+        var wait time.Duration
+        wait, s.discoveryFactor = nextBackoff(s.cfg.Polling.Backoff, s.discoveryFactor, s.rand)
+        s.mu.Unlock()
+
+        s.nextDiscovery = time.Now().Add(wait)
+        log.Error().Err(err).Dur("Backoff", wait).Msg("Unable to discover devices")
+        return
+    }
+
+    s.addDevices(setUpDiscoveredDevices(discovered))
+    s.nextDiscovery = time.Now().Add(time.Duration(s.cfg.Discovery.Interval))
+    s.discoveryFactor = 1
+}
+
+// poll fetches the statistics of a device and schedules its next poll.
+func (s *scheduler) poll(ctx context.Context, device *deviceSchedule) error {
+    update, err := s.fetch(ctx, device)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    device.polling = false
+
+    if err != nil && ctx.Err() != nil {
+        // Cancelled while stopping, the outcome says nothing about the device.
+        return err
+    }
+    device.healthy = err == nil
+    label := device.descriptor.Label
+
+    up := 0.0
+    for _, other := range s.devices {
+        if other.healthy {
+            up = 1
+        }
+    }
+    upGauge.Set(up)
+
+    if err != nil {
+        var wait time.Duration
+        var rateLimitErr *melcloud.RateLimitError
+
+        if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > 0 {
+            // MELCloud told us when to retry, no need to guess.
+            wait = rateLimitErr.RetryAfter
+        } else {
+            wait = s.backoff(device)
+        }
+        backoffFactorGauge.WithLabelValues(label).Set(float64(device.backoffFactor))
+        device.nextPoll = time.Now().Add(wait)
+        log.Debug().Str("Label", label).Dur("Backoff", wait).Msg("Fetch failed - backing off")
+
+        // if we are ratelimited or logged out, hold off requests for other devices too.
+        if errors.Is(err, melcloud.ErrTooManyRequests) || errors.Is(err, melcloud.ErrUnauthorized) {
+            for _, other := range s.devices {
+                if other.nextPoll.Before(device.nextPoll) {
+                    other.nextPoll = device.nextPoll
+                }
+            }
+        }
+
+        return err
+    }
+
+    device.lastSuccess = time.Now()
+
+    // reset backoff factor after the fetch succeeded.
+    device.backoffFactor = 1
+    backoffFactorGauge.WithLabelValues(label).Set(float64(device.backoffFactor))
+    device.nextPoll = s.nextPollAfter(device.descriptor, update)
+
+    return nil
+}
+
+// maxBackoffFactor bounds the backoff factor, which would otherwise grow forever when the
+// multiplier never lets the wait reach the configured maximum.
+const maxBackoffFactor = 32
+
+// nextBackoff returns how long to wait after a failure at the given backoff factor, and the
+// factor to use for the next failure.
+func nextBackoff(policy config.BackoffConfig, factor int, random *rand.Rand) (time.Duration, int) {
+    wait := time.Duration(float64(policy.Base) * math.Pow(policy.Multiplier, float64(factor - 1)))
+
+    if max := time.Duration(policy.Max); wait >= max {
+        wait = max
+    } else if factor < maxBackoffFactor {
+        factor += 1
+    }
+
+    // Spread retries by ±jitter so that exporters failing together don't retry together.
+    jitter := policy.Jitter * (2 * random.Float64() - 1)
+    return time.Duration(float64(wait) * (1 + jitter)), factor
+}
+
+// backoff returns how long to wait before polling a device which failed to be fetched, and
+// increases its backoff factor. Must be called with the lock held.
+func (s *scheduler) backoff(device *deviceSchedule) time.Duration {
+    var wait time.Duration
+    wait, device.backoffFactor = nextBackoff(s.cfg.Polling.Backoff, device.backoffFactor, s.rand)
+
+    return wait
+}
+
+// withJitter delays a scheduled poll by a random fraction of the time until it, up to the
+// configured jitter, but never past `latest`. Must be called with the lock held.
+func (s *scheduler) withJitter(now, next, latest time.Time) time.Time {
+    jittered := next.Add(time.Duration(float64(next.Sub(now)) * s.cfg.Polling.Backoff.Jitter * s.rand.Float64()))
+    if jittered.After(latest) {
+        return latest
+    }
+    return jittered
+}
+
+// nextPollAfter clamps the next communication time suggested by MELCloud to the configured
+// polling interval bounds.
+func (s *scheduler) nextPollAfter(descriptor config.MELCloudDeviceDescriptor, update *driver.Update) time.Time {
+    minInterval := descriptor.MinInterval.Or(time.Duration(s.cfg.Polling.MinInterval))
+    maxInterval := descriptor.MaxInterval.Or(time.Duration(s.cfg.Polling.MaxInterval))
+
+    var next time.Time
+    if update != nil {
+        next = update.NextCommunication
+    }
+
+    now := time.Now()
+
+    if next.Before(now.Add(minInterval)) {
+        // the date might be zero or in the past (likely due to some sort of time skew).
+        log.Debug().
+            Str("Label", descriptor.Label).
+            Stringer("NextTick", next).
+            Dur("MinInterval", minInterval).
+            Msg("Ignoring suggested next tick as it's zero or too small")
+        return s.withJitter(now, now.Add(minInterval), now.Add(maxInterval))
+    }
+
+    if next.After(now.Add(maxInterval)) {
+        // do not bother waiting more than the max interval for an update.
+        log.Debug().
+            Str("Label", descriptor.Label).
+            Stringer("NextTick", next).
+            Dur("MaxInterval", maxInterval).
+            Msg("Ignoring suggested next tick as it's too far")
+        return now.Add(maxInterval)
+    }
+
+    return s.withJitter(now, next, now.Add(maxInterval))
+}
+
+// fetch retrieves and parses the statistics of a device, and updates its energy report when
+// due.
+func (s *scheduler) fetch(ctx context.Context, device *deviceSchedule) (*driver.Update, error) {
+    descriptor := device.descriptor
+
+    log.Debug().Str("Label", descriptor.Label).Msg("Fetching statistics for device")
+
+    fetchAttempts.WithLabelValues(descriptor.Label).Inc()
+    fetchStart := time.Now()
+
+    reader, err := s.requestor.GetDeviceInformation(ctx, descriptor.Id, descriptor.BuildingId)
+
+    if err != nil && ctx.Err() != nil {
+        return nil, err
+    }
+
+    if err != nil {
+        fetchDuration.WithLabelValues(descriptor.Label).Observe(time.Since(fetchStart).Seconds())
+        fetchFailures.WithLabelValues(descriptor.Label, fetchFailureReason(err)).Inc()
+        log.Error().
+            Err(err).
+            Str("Label", descriptor.Label).
+            Str("DeviceType", string(descriptor.Type)).
+            Str("DeviceID", descriptor.Id).
+            Str("BuildingID", descriptor.BuildingId).
+            Msg("Failed to fetch statistics")
+        if reader != nil {
+            reader.Close()
+        }
+        return nil, err
+    }
+
+    statsManager := lookupStatsManager(descriptor.Label)
+    update, err := statsManager.ParseAndUpdateStats(reader)
+    reader.Close()
+    fetchDuration.WithLabelValues(descriptor.Label).Observe(time.Since(fetchStart).Seconds())
+
+    if err != nil {
+        fetchFailures.WithLabelValues(descriptor.Label, failureDecode).Inc()
+        log.Error().
+            Err(err).
+            Str("Label", descriptor.Label).
+            Str("DeviceType", string(descriptor.Type)).
+            Str("DeviceID", descriptor.Id).
+            Str("BuildingID", descriptor.BuildingId).
+            Msg("Failed to decode model from statistics")
+        return nil, err
+    }
+
+    lastSuccessfulFetch.WithLabelValues(descriptor.Label).SetToCurrentTime()
+
+    updater, ok := statsManager.(driver.EnergyReportUpdater)
+    if ok && time.Since(device.lastEnergyReport) >= time.Duration(s.cfg.EnergyReportInterval) {
+        // Energy reports are best-effort and never fail the fetch as a whole.
+        var requestErr error
+        energyErr := updater.UpdateEnergyReport(func(from, to time.Time) (io.ReadCloser, error) {
+            body, err := s.requestor.GetEnergyReport(ctx, descriptor.Id, from, to)
+            if err != nil {
+                requestErr = err
+            }
+            return body, err
+        })
+
+        if energyErr != nil {
+            reason := failureDecode
+            if requestErr != nil {
+                reason = fetchFailureReason(requestErr)
+            }
+            energyReportFailures.WithLabelValues(descriptor.Label, reason).Inc()
+
+            log.Warn().
+                Err(energyErr).
+                Str("Label", descriptor.Label).
+                Str("DeviceID", descriptor.Id).
+                Msg("Failed to update energy report")
+        } else {
+            device.lastEnergyReport = time.Now()
+        }
+    }
+
+    return update, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/rs/zerolog/log"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+    "rbf.dev/melcloud_prometheus_exporter/melcloud"
+)
+
+// Cached sessions expiring sooner than this are not reused, as MELCloud reports the expiry
+// without a time zone.
+const sessionExpiryMargin = 24 * time.Hour
+
+type sessionState struct {
+    // Account the session belongs to, so that it's not reused after changing credentials.
+    Mail string
+    ContextKey string
+    Expiry time.Time
+}
+
+func loadSession(path, mail string) (*melcloud.Session, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var state sessionState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return nil, fmt.Errorf("unable to decode session state: %w", err)
+    }
+
+    if state.Mail != mail || state.ContextKey == "" {
+        return nil, fmt.Errorf("cached session belongs to a different account")
+    }
+
+    if state.Expiry.IsZero() || time.Until(state.Expiry) < sessionExpiryMargin {
+        return nil, fmt.Errorf("cached session expired at %v", state.Expiry)
+    }
+
+    return &melcloud.Session{ContextKey: state.ContextKey, Expiry: state.Expiry}, nil
+}
+
+func saveSession(path, mail string, session melcloud.Session) error {
+    data, err := json.Marshal(sessionState{mail, session.ContextKey, session.Expiry})
+    if err != nil {
+        return err
+    }
+
+    // Write to a temporary file first so that a crash never leaves a truncated state behind.
+    tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path) + ".*")
+    if err != nil {
+        return err
+    }
+
+    defer os.Remove(tmp.Name())
+
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+
+    return os.Rename(tmp.Name(), path)
+}
+
+// newRequestor returns a requestor for the configured account, without logging in. When a
+// state file is configured, a cached session is reused if still valid, and new sessions are
+// written back to it.
+func newRequestor(cfg config.MELCloudConfig) *melcloud.MelcloudRequestor {
+    endpoint := melcloud.Endpoint{BaseURL: cfg.BaseURL, AppVersion: cfg.AppVersion}
+
+    var session melcloud.Session
+
+    if cfg.StateFile != "" {
+        cached, err := loadSession(cfg.StateFile, cfg.Mail)
+        if err == nil {
+            log.Info().Time("Expiry", cached.Expiry).Msg("Reusing cached MELCloud session")
+            session = *cached
+        } else if !errors.Is(err, os.ErrNotExist) {
+            log.Warn().Err(err).Str("StateFile", cfg.StateFile).Msg("Not reusing cached MELCloud session")
+        }
+    }
+
+    requestor := melcloud.Resume(endpoint, cfg.Mail, cfg.Password, session)
+
+    if cfg.StateFile != "" {
+        requestor.SetLoginHook(func(session melcloud.Session) {
+            if err := saveSession(cfg.StateFile, cfg.Mail, session); err != nil {
+                log.Warn().Err(err).Str("StateFile", cfg.StateFile).Msg("Unable to cache MELCloud session")
+            }
+        })
+    }
+
+    if rateLimit := cfg.RateLimit; rateLimit.RequestsPerHour > 0 {
+        requestor.SetRateLimiter(melcloud.NewRateLimiter(rateLimit.RequestsPerHour, rateLimit.Burst))
+    }
+
+    return requestor
+}
+
+// authenticate returns a requestor for the configured account, logging in unless a cached
+// session can be reused.
+func authenticate(ctx context.Context, cfg config.MELCloudConfig) (*melcloud.MelcloudRequestor, error) {
+    requestor := newRequestor(cfg)
+
+    if err := requestor.Login(ctx); err != nil {
+        return nil, err
+    }
+
+    return requestor, nil
+}
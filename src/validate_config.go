@@ -0,0 +1,29 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+)
+
+// validateConfig implements the `validate-config` subcommand, which checks the config without
+// contacting MELCloud and exits with a non-zero status if it's invalid.
+func validateConfig(args []string) {
+    flags := flag.NewFlagSet("validate-config", flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Fprintf(flags.Output(), "Usage: %v validate-config <config-path>\n", os.Args[0])
+    }
+    flags.Parse(args)
+
+    if flags.NArg() < 1 {
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    if _, err := loadConfig(flags.Arg(0)); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+
+    fmt.Println("Config is valid")
+}
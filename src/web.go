@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+
+    "github.com/prometheus/exporter-toolkit/web"
+    "github.com/rs/zerolog"
+    "github.com/rs/zerolog/log"
+    "gopkg.in/yaml.v2"
+
+    "rbf.dev/melcloud_prometheus_exporter/config"
+)
+
+// validateWebConfig validates a web config file of the Prometheus exporter-toolkit, see
+// https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md
+func validateWebConfig(path string) error {
+    if err := web.Validate(path); err != nil {
+        return err
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+
+    var c web.Config
+    if err := yaml.Unmarshal(data, &c); err != nil {
+        return err
+    }
+
+    // Without client CAs, the toolkit verifies client certificates against the system roots,
+    // which would accept any publicly trusted certificate.
+    tlsCfg := c.TLSConfig
+    verifying := tlsCfg.ClientAuth == "RequireAndVerifyClientCert" || tlsCfg.ClientAuth == "VerifyClientCertIfGiven"
+    if verifying && tlsCfg.ClientCAs == "" && tlsCfg.ClientCAsText == "" {
+        return fmt.Errorf("client_auth_type '%v' requires client_ca_file or client_ca", tlsCfg.ClientAuth)
+    }
+
+    return nil
+}
+
+// toolkitLogger forwards the log lines of the exporter-toolkit to zerolog.
+type toolkitLogger struct{}
+
+func (toolkitLogger) Log(keyvals ...interface{}) error {
+    level := zerolog.InfoLevel
+    message := ""
+    fields := make(map[string]interface{}, len(keyvals) / 2)
+
+    for i := 0; i + 1 < len(keyvals); i += 2 {
+        switch key := fmt.Sprint(keyvals[i]); key {
+        case "level":
+            if parsed, err := zerolog.ParseLevel(fmt.Sprint(keyvals[i + 1])); err == nil {
+                level = parsed
+            }
+        case "msg":
+            message = fmt.Sprint(keyvals[i + 1])
+        default:
+            fields[key] = keyvals[i + 1]
+        }
+    }
+
+    log.WithLevel(level).Fields(fields).Msg(message)
+    return nil
+}
+
+// listenAndServe serves the default mux on the configured address until the context is done,
+// then shuts the server down gracefully. When a web config file is set, TLS and basic
+// authentication are enabled according to it by the exporter-toolkit.
+func listenAndServe(ctx context.Context, cfg *config.Config) error {
+    server := &http.Server{}
+
+    listener, err := net.Listen("tcp", cfg.ListenAddress)
+    if err != nil {
+        return fmt.Errorf("unable to listen: %w", err)
+    }
+
+    served := make(chan struct{})
+    shutDown := make(chan error, 1)
+
+    go func() {
+        select {
+        case <-ctx.Done():
+        case <-served:
+            shutDown <- nil
+            return
+        }
+
+        log.Info().Msg("Shutting down Prometheus server")
+
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+        defer cancel()
+
+        shutDown <- server.Shutdown(shutdownCtx)
+    }()
+
+    err = web.Serve(listener, server, &web.FlagConfig{WebConfigFile: &cfg.WebConfigFile}, toolkitLogger{})
+    close(served)
+
+    if errors.Is(err, http.ErrServerClosed) {
+        // Wait for in-flight requests to complete.
+        return <-shutDown
+    }
+
+    return err
+}